@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/AlfredBerg/rod-crawler/crawler"
+	"github.com/go-rod/rod/lib/devices"
+	"github.com/go-rod/rod/lib/launcher"
+	launcherFlags "github.com/go-rod/rod/lib/launcher/flags"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// devicePresets are the devices that can be emulated with --device
+var devicePresets = map[string]devices.Device{
+	"laptop":       devices.LaptopWithMDPIScreen.Landscape(),
+	"laptop-hidpi": devices.LaptopWithHiDPIScreen.Landscape(),
+	"laptop-touch": devices.LaptopWithTouch.Landscape(),
+	"iphone-se":    devices.IPhone5orSE,
+	"iphone-8":     devices.IPhone6or7or8,
+	"iphone-x":     devices.IPhoneX,
+	"pixel-2":      devices.Pixel2,
+	"galaxy-s5":    devices.GalaxyS5,
+	"ipad":         devices.IPad,
+	"ipad-pro":     devices.IPadPro,
+}
+
+func devicePresetNames() []string {
+	names := []string{}
+	for name := range devicePresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newLauncher creates a launcher for a local browser with the binary and extra chromium flags given as flags
+func newLauncher() *launcher.Launcher {
+	l := launcher.New().
+		Headless(!flags.debug).
+		Devtools(flags.debug)
+
+	if flags.browserBin != "" {
+		l = l.Bin(flags.browserBin)
+	}
+	if flags.acceptLanguage != "" {
+		l = l.Set("lang", primaryLanguage(flags.acceptLanguage))
+	}
+	for _, f := range flags.browserFlags {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(f, "-"), "=")
+		if hasValue {
+			l = l.Set(launcherFlags.Flag(name), value)
+		} else {
+			l = l.Set(launcherFlags.Flag(name))
+		}
+	}
+	return l
+}
+
+// browserDevice is the device every new tab emulates, the preset given by --device with the user agent,
+// accept language and viewport flags applied on top of it
+func browserDevice() (devices.Device, error) {
+	device, ok := devicePresets[flags.device]
+	if !ok {
+		return devices.Device{}, fmt.Errorf("unknown device %q, must be one of %s", flags.device, strings.Join(devicePresetNames(), ", "))
+	}
+
+	if flags.userAgent != "" {
+		device.UserAgent = flags.userAgent
+	}
+	if flags.acceptLanguage != "" {
+		device.AcceptLanguage = flags.acceptLanguage
+	}
+	if flags.viewport != "" {
+		var size devices.ScreenSize
+		_, err := fmt.Sscanf(flags.viewport, "%dx%d", &size.Width, &size.Height)
+		if err != nil {
+			return devices.Device{}, fmt.Errorf("viewport %q must be given as WIDTHxHEIGHT: %w", flags.viewport, err)
+		}
+		//The orientation of the preset decides which of them is used
+		device.Screen.Horizontal = size
+		device.Screen.Vertical = size
+	}
+	return device, nil
+}
+
+// browserEmulation is the emulation applied to each crawling tab
+func browserEmulation() (crawler.Emulation, error) {
+	e := crawler.Emulation{Timezone: flags.timezone}
+	if flags.acceptLanguage != "" {
+		e.Locale = strings.ReplaceAll(primaryLanguage(flags.acceptLanguage), "-", "_")
+	}
+
+	if flags.geolocation != "" {
+		parts := strings.Split(flags.geolocation, ",")
+		if len(parts) < 2 || len(parts) > 3 {
+			return e, fmt.Errorf("geolocation %q must be given as LATITUDE,LONGITUDE[,ACCURACY]", flags.geolocation)
+		}
+		values := []float64{}
+		for _, p := range parts {
+			v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+			if err != nil {
+				return e, fmt.Errorf("invalid geolocation %q: %w", flags.geolocation, err)
+			}
+			values = append(values, v)
+		}
+		accuracy := 1.0
+		if len(values) == 3 {
+			accuracy = values[2]
+		}
+		e.Geolocation = &proto.EmulationSetGeolocationOverride{Latitude: &values[0], Longitude: &values[1], Accuracy: &accuracy}
+	}
+	return e, nil
+}
+
+// primaryLanguage is the first language of an Accept-Language value, e.g. sv-SE for "sv-SE,sv;q=0.9,en;q=0.8"
+func primaryLanguage(acceptLanguage string) string {
+	lang, _, _ := strings.Cut(acceptLanguage, ",")
+	lang, _, _ = strings.Cut(lang, ";")
+	return strings.TrimSpace(lang)
+}
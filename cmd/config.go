@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+var configForce bool
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage the config file",
+}
+
+var configInitCmd = &cobra.Command{
+	Use:   "init [file]",
+	Short: "Write a config file with all options set to their defaults (default file is $HOME/.rod-crawler.yaml)",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var file string
+		if len(args) == 1 {
+			file = args[0]
+		} else {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return err
+			}
+			file = filepath.Join(home, ".rod-crawler.yaml")
+		}
+
+		if _, err := os.Stat(file); err == nil && !configForce {
+			return fmt.Errorf("%s already exists, use --force to overwrite it", file)
+		}
+
+		err := os.WriteFile(file, []byte(defaultConfig(rootCmd)), 0o600)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, "Wrote config file:", file)
+		return nil
+	},
+}
+
+func init() {
+	configInitCmd.Flags().BoolVarP(&configForce, "force", "f", false, "Overwrite the config file if it already exists.")
+	configCmd.AddCommand(configInitCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+// defaultConfig renders a yaml config with every flag set to its default value, documented with the flag usage.
+// The flags of a subcommand are in a section named after it, see configKey.
+func defaultConfig(root *cobra.Command) string {
+	var sb strings.Builder
+	sb.WriteString("# rod-crawler config file. Flags given on the command line take precedence over this file,\n")
+	sb.WriteString("# and ROD_CRAWLER_* environment variables (e.g. ROD_CRAWLER_SAVE_RESPONSES=true or ROD_CRAWLER_MINE_BATCH_SIZE=10)\n")
+	sb.WriteString("# take precedence over the file.\n")
+	writeConfigFlags(&sb, root, "")
+	return sb.String()
+}
+
+func writeConfigFlags(sb *strings.Builder, cmd *cobra.Command, indent string) {
+	cmd.LocalFlags().VisitAll(func(f *pflag.Flag) {
+		if f.Name == "help" || f.Name == "config" {
+			return
+		}
+		sb.WriteString("\n" + indent + "# " + f.Usage + "\n")
+		sb.WriteString(indent + f.Name + ": " + yamlValue(f) + "\n")
+	})
+
+	for _, sub := range cmd.Commands() {
+		if sub == configCmd || !hasConfigFlags(sub) {
+			continue
+		}
+		sb.WriteString("\n" + indent + sub.Name() + ":\n")
+		writeConfigFlags(sb, sub, indent+"  ")
+	}
+}
+
+// hasConfigFlags tells if the command or one of its subcommands has flags of its own
+func hasConfigFlags(cmd *cobra.Command) bool {
+	has := false
+	cmd.LocalFlags().VisitAll(func(f *pflag.Flag) {
+		has = has || f.Name != "help"
+	})
+	for _, sub := range cmd.Commands() {
+		has = has || hasConfigFlags(sub)
+	}
+	return has
+}
+
+func yamlValue(f *pflag.Flag) string {
+	if sv, ok := f.Value.(pflag.SliceValue); ok {
+		values := []string{}
+		for _, v := range sv.GetSlice() {
+			values = append(values, strconv.Quote(v))
+		}
+		return "[" + strings.Join(values, ", ") + "]"
+	}
+
+	switch f.Value.Type() {
+	case "bool", "int":
+		return f.DefValue
+	default:
+		return strconv.Quote(f.DefValue)
+	}
+}
+
+// configKey is the config key of a flag of cmd. The flags of the crawl and the global flags are top level keys, the
+// flags of a subcommand are in its section as the same names mean different things, e.g. mine.concurrency.
+func configKey(cmd *cobra.Command, f *pflag.Flag) string {
+	if cmd.InheritedFlags().Lookup(f.Name) == f {
+		return f.Name
+	}
+	path := strings.Fields(cmd.CommandPath())[1:]
+	return strings.Join(append(path, f.Name), ".")
+}
+
+// applyConfig sets every flag of cmd that was not given on the command line from the config file or environment.
+// This makes the precedence flag > environment > config file > default.
+func applyConfig(cmd *cobra.Command) error {
+	var errs []error
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		key := configKey(cmd, f)
+		if f.Changed || !viper.IsSet(key) {
+			return
+		}
+
+		var err error
+		sv, isSlice := f.Value.(pflag.SliceValue)
+		switch v := viper.Get(key).(type) {
+		case []any, []string:
+			if !isSlice {
+				err = fmt.Errorf("a list is given but it takes one value")
+				break
+			}
+			err = sv.Replace(viper.GetStringSlice(key))
+		default:
+			//A string slice parses the value as csv, a string array takes it as one value
+			err = f.Value.Set(fmt.Sprint(v))
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid config value for %s: %w", key, err))
+		}
+	})
+	return errors.Join(errs...)
+}
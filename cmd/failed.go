@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/AlfredBerg/rod-crawler/internal/metrics"
+	"github.com/AlfredBerg/rod-crawler/internal/outputHandlers/sqlite"
+	"github.com/spf13/cobra"
+)
+
+var failedFlags struct {
+	database string
+	canceled bool
+	verbose  bool
+}
+
+var failedCmd = &cobra.Command{
+	Use:   "failed",
+	Short: "List the targets whose last crawl failed, one per line so they can be given to the crawl again with -t",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		//A target crawled again in a later run is only listed if that crawl failed as well
+		last := map[string]metrics.Result{}
+		order := []string{}
+		err := sqlite.ReadResults(failedFlags.database, func(r metrics.Result) error {
+			if _, ok := last[r.Target]; !ok {
+				order = append(order, r.Target)
+			}
+			last[r.Target] = r
+			return nil
+		})
+		if errors.Is(err, sqlite.ErrNoTable) {
+			return fmt.Errorf("%s has no results of crawled targets, it was written by a version of the crawler that did not save them", failedFlags.database)
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, target := range order {
+			r := last[target]
+			if r.Status != metrics.StatusFailed && !(failedFlags.canceled && r.Status == metrics.StatusCanceled) {
+				continue
+			}
+			if failedFlags.verbose {
+				_, err = fmt.Fprintf(os.Stdout, "%s\t%s\t%s\t%s\n", r.Target, r.Status, r.StopReason, r.Error)
+			} else {
+				_, err = fmt.Fprintln(os.Stdout, r.Target)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	failedCmd.Flags().StringVar(&failedFlags.database, "db", "req.db", "The sqlite database file written by the crawl.")
+	failedCmd.Flags().BoolVar(&failedFlags.canceled, "canceled", false, "Also list the targets whose crawl was stopped before it was done, e.g. by an interrupt.")
+	failedCmd.Flags().BoolVarP(&failedFlags.verbose, "verbose", "v", false, "List the status, stop reason and error of each target as well, tab separated.")
+	rootCmd.AddCommand(failedCmd)
+}
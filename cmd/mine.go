@@ -0,0 +1,238 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/AlfredBerg/rod-crawler/internal/mine"
+	"github.com/AlfredBerg/rod-crawler/internal/outputHandlers/sqlite"
+	"github.com/AlfredBerg/rod-crawler/internal/params"
+	"github.com/AlfredBerg/rod-crawler/internal/scope"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var mineFlags struct {
+	database    string
+	wordlist    string
+	batchSize   int
+	concurrency int
+	methods     []string
+	scope       []string
+	headers     []string
+}
+
+// Endpoints with these extensions are static files that don't take parameters
+var staticExtensions = map[string]bool{
+	".js": true, ".mjs": true, ".css": true, ".map": true, ".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".svg": true,
+	".ico": true, ".webp": true, ".avif": true, ".woff": true, ".woff2": true, ".ttf": true, ".eot": true, ".otf": true,
+	".mp4": true, ".webm": true, ".mp3": true, ".pdf": true, ".zip": true,
+}
+
+// Headers of the captured requests that are not replayed, the http client sets them itself
+var skippedSessionHeaders = map[string]bool{"Content-Length": true, "Content-Type": true, "Host": true, "Accept-Encoding": true}
+
+var mineCmd = &cobra.Command{
+	Use:   "mine",
+	Short: "Find hidden parameters of the endpoints in the database, the found parameters are added to the parameter inventory",
+	Long: `Find hidden parameters of the endpoints requested while crawling. Candidate names from the wordlist, the parameter
+inventory and the captured javascript are sent in batches with the headers of the last captured request to the host,
+and the names that change the response are saved to the parameter inventory with the source "mining".`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if mineFlags.batchSize <= 0 {
+			return fmt.Errorf("--batch-size must be greater than 0, got %d", mineFlags.batchSize)
+		}
+		if mineFlags.concurrency <= 0 {
+			return fmt.Errorf("--concurrency must be greater than 0, got %d", mineFlags.concurrency)
+		}
+
+		extraHeaders, err := parseHeaders(mineFlags.headers)
+		if err != nil {
+			return err
+		}
+
+		candidates := newNameSet()
+		if mineFlags.wordlist == "" {
+			candidates.add(mine.DefaultWordlist...)
+		} else {
+			words, err := readLines(mineFlags.wordlist)
+			if err != nil {
+				return err
+			}
+			candidates.add(words...)
+		}
+
+		//Known parameters are not hidden, but their names are good candidates for the other endpoints
+		known := map[string]bool{}
+		inScope := mineFlags.scope
+		err = sqlite.ReadParameters(mineFlags.database, func(p params.Parameter) error {
+			known[p.Key()] = true
+			if p.Location != "cookie" && p.Location != "header" {
+				candidates.add(p.Name)
+			}
+			if host := strings.Split(p.Host, ":")[0]; len(mineFlags.scope) == 0 && !slices.Contains(inScope, host) {
+				inScope = append(inScope, host)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if len(inScope) == 0 {
+			return fmt.Errorf("no scope given and there are no parameters in the database to take it from")
+		}
+
+		err = sqlite.ReadResponses(mineFlags.database, func(u string, headers map[string][]string, body string) error {
+			if strings.Contains(http.Header(headers).Get("Content-Type"), "javascript") || path.Ext(strings.Split(u, "?")[0]) == ".js" {
+				candidates.add(mine.NamesFromJavascript(body)...)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		endpoints := []string{}
+		seen := map[string]bool{}
+		sessions := map[string]http.Header{}
+		err = sqlite.ReadRequests(mineFlags.database, func(u, method string, headers map[string][]string) error {
+			parsed, err := url.Parse(u)
+			if err != nil || !scope.InScope(parsed.Hostname(), inScope) || staticExtensions[strings.ToLower(path.Ext(parsed.Path))] {
+				return nil
+			}
+
+			//The last request to a host has the most recent session
+			session := http.Header{}
+			for name, values := range headers {
+				if !skippedSessionHeaders[http.CanonicalHeaderKey(name)] {
+					session[name] = values
+				}
+			}
+			for name, value := range extraHeaders {
+				session.Set(name, value)
+			}
+			sessions[parsed.Host] = session
+
+			endpoint := parsed.Scheme + "://" + parsed.Host + parsed.EscapedPath()
+			if !seen[endpoint] {
+				seen[endpoint] = true
+				endpoints = append(endpoints, endpoint)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		outputHandler := sqlite.SqliteOutput{Database: mineFlags.database}
+		err = outputHandler.Init()
+		if err != nil {
+			return err
+		}
+		defer outputHandler.Cleanup()
+		inventory := params.NewInventory()
+		names := candidates.names
+
+		zap.L().Info("mining parameters", zap.Int("endpoints", len(endpoints)), zap.Int("candidates", len(names)))
+
+		jobs := make(chan string)
+		wg := sync.WaitGroup{}
+		for i := 0; i < mineFlags.concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for endpoint := range jobs {
+					u, _ := url.Parse(endpoint)
+					miner := mine.New(sessions[u.Host], mineFlags.batchSize)
+					for _, method := range mineFlags.methods {
+						method = strings.ToUpper(method)
+						location := "query"
+						if method != http.MethodGet {
+							location = "body"
+						}
+
+						found, err := miner.Mine(method, endpoint, names)
+						if err != nil {
+							zap.L().Error("mining failed", zap.Error(err), zap.String("endpoint", endpoint), zap.String("method", method))
+						}
+						for _, name := range found {
+							p := params.Parameter{Host: u.Host, Path: u.EscapedPath(), Location: location, Name: name}
+							if p.Path == "" {
+								p.Path = "/"
+							}
+							if known[p.Key()] {
+								continue
+							}
+							for _, p := range inventory.Add(u, "mining", endpoint, []params.Found{{Location: location, Name: name}}) {
+								fmt.Fprintf(os.Stdout, "%s\t%s\t%s\n", method, endpoint, p.Name)
+								outputHandler.HandleParameter(p)
+							}
+						}
+					}
+				}
+			}()
+		}
+
+		for _, e := range endpoints {
+			jobs <- e
+		}
+		close(jobs)
+		wg.Wait()
+		return nil
+	},
+}
+
+// nameSet keeps the order names were added in without duplicates
+type nameSet struct {
+	names []string
+	seen  map[string]bool
+}
+
+func newNameSet() *nameSet {
+	return &nameSet{seen: map[string]bool{}}
+}
+
+func (s *nameSet) add(names ...string) {
+	for _, n := range names {
+		if n != "" && !s.seen[n] {
+			s.seen[n] = true
+			s.names = append(s.names, n)
+		}
+	}
+}
+
+func readLines(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	lines := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+func init() {
+	mineCmd.Flags().StringVar(&mineFlags.database, "db", "req.db", "The sqlite database file written by the crawl.")
+	mineCmd.Flags().StringVarP(&mineFlags.wordlist, "wordlist", "w", "", "File with one candidate parameter name per line, a short list of common names is used if not given.")
+	mineCmd.Flags().IntVar(&mineFlags.batchSize, "batch-size", 30, "How many candidate names are sent in one request.")
+	mineCmd.Flags().IntVarP(&mineFlags.concurrency, "concurrency", "c", 5, "How many endpoints are mined at the same time.")
+	mineCmd.Flags().StringSliceVar(&mineFlags.methods, "method", []string{"GET"}, "The methods to mine with, the candidates are sent in the query for GET and as a form body otherwise.")
+	mineCmd.Flags().StringSliceVarP(&mineFlags.scope, "scope", "s", nil, "Only mine the endpoints of these hosts and their subdomains, by default the hosts in the parameter inventory.")
+	mineCmd.Flags().StringArrayVarP(&mineFlags.headers, "header", "H", nil, "Extra header sent with every request, it replaces the captured header with the same name.")
+	rootCmd.AddCommand(mineCmd)
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/AlfredBerg/rod-crawler/internal/outputHandlers/sqlite"
+	"github.com/AlfredBerg/rod-crawler/internal/params"
+	"github.com/spf13/cobra"
+)
+
+var paramsFlags struct {
+	database string
+	host     string
+	location string
+}
+
+var paramsCmd = &cobra.Command{
+	Use:   "params",
+	Short: "List the parameters found while crawling, tab separated as host, path, location, name, source and sample values",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return sqlite.ReadParameters(paramsFlags.database, func(p params.Parameter) error {
+			if paramsFlags.host != "" && p.Host != paramsFlags.host {
+				return nil
+			}
+			if paramsFlags.location != "" && p.Location != paramsFlags.location {
+				return nil
+			}
+			_, err := fmt.Fprintf(os.Stdout, "%s\t%s\t%s\t%s\t%s\t%s\n", p.Host, p.Path, p.Location, p.Name, p.Source, strings.Join(p.Samples, ","))
+			return err
+		})
+	},
+}
+
+func init() {
+	paramsCmd.Flags().StringVar(&paramsFlags.database, "db", "req.db", "The sqlite database file written by the crawl.")
+	paramsCmd.Flags().StringVar(&paramsFlags.host, "host", "", "Only list the parameters of this host, including the port if it is not the default one.")
+	paramsCmd.Flags().StringVar(&paramsFlags.location, "location", "", "Only list the parameters in this location: query, body, json, multipart, cookie or header.")
+	rootCmd.AddCommand(paramsCmd)
+}
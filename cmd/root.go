@@ -2,18 +2,17 @@ package cmd
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
-	"sync"
+	"syscall"
 	"time"
 
-	"github.com/AlfredBerg/rod-crawler/internal/crawl"
-	"github.com/AlfredBerg/rod-crawler/internal/outputHandlers/sqlite"
-	"github.com/go-rod/rod"
-	"github.com/go-rod/rod/lib/launcher"
-	"github.com/go-rod/rod/lib/proto"
+	"github.com/AlfredBerg/rod-crawler/crawler"
+	"github.com/AlfredBerg/rod-crawler/hooks"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
@@ -22,6 +21,9 @@ import (
 
 var cfgFile string
 
+// Hooks are called around the crawl lifecycle of every target, a program embedding the crawler sets them before calling Execute
+var Hooks hooks.Hooks
+
 type crawlFlags struct {
 	targets               string
 	concurrency           int
@@ -30,8 +32,39 @@ type crawlFlags struct {
 	logLevel              logLevel
 
 	saveResponses bool
-
-	scope []string
+	sourceMaps    bool
+	domXss        bool
+	reflection    bool
+	scriptsDir    string
+	output        string
+	headers       []string
+
+	navigationTimeout time.Duration
+	navigationRetries int
+	navigationBackoff time.Duration
+	stabilityWait     time.Duration
+	clickTimeout      time.Duration
+	maxActions        int
+	maxPageStates     int
+	maxAttempts       int
+
+	scope           []string
+	maxDepth        int
+	maxPagesPerHost int
+	seed            bool
+
+	browserURLs    []string
+	browserRetries int
+	sharedSession  bool
+
+	browserBin     string
+	browserFlags   []string
+	device         string
+	userAgent      string
+	viewport       string
+	timezone       string
+	geolocation    string
+	acceptLanguage string
 }
 
 var flags crawlFlags
@@ -70,19 +103,56 @@ func Execute() error {
 }
 
 func init() {
-	flags = crawlFlags{}
+	flags = crawlFlags{logLevel: info}
 
 	cobra.OnInitialize(initConfig)
 
-	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.req-diff.yaml)")
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.rod-crawler.yaml)")
 	rootCmd.Flags().StringVarP(&flags.targets, "target", "t", "", "A file containing the urls to crawl. If empty stdin is used.")
 	rootCmd.Flags().IntVarP(&flags.concurrency, "concurrency", "c", 2, "The number of browsers to be used for crawling at the same time.")
 	rootCmd.Flags().IntVar(&flags.perCrawltargetTimeout, "timeout", 60, "The maximum amount of time in seconds to spend on one crawling target.")
+	rootCmd.Flags().DurationVar(&flags.navigationTimeout, "navigation-timeout", crawler.DefaultBudget.NavigationTimeout, "How long the navigation to a target may take.")
+	rootCmd.Flags().IntVar(&flags.navigationRetries, "navigation-retries", crawler.DefaultBudget.NavigationRetries, "How many times a failed navigation to a target is tried again. 0 means never.")
+	rootCmd.Flags().DurationVar(&flags.navigationBackoff, "navigation-backoff", crawler.DefaultBudget.NavigationBackoff, "How long to wait before retrying a failed navigation, doubled for every retry.")
+	rootCmd.Flags().DurationVar(&flags.stabilityWait, "stability-wait", crawler.DefaultBudget.StabilityWait, "How long to wait for a page to become stable before clicking on it.")
+	rootCmd.Flags().DurationVar(&flags.clickTimeout, "click-timeout", crawler.DefaultBudget.ClickTimeout, "How long scrolling to and clicking an element may take.")
+	rootCmd.Flags().IntVar(&flags.maxActions, "max-actions", crawler.DefaultBudget.MaxActions, "The maximum number of clicks per target. Must be greater than 0.")
+	rootCmd.Flags().IntVar(&flags.maxPageStates, "max-page-states", crawler.DefaultBudget.MaxPageStates, "The maximum number of distinct pages and client side routes crawled per target. 0 means no limit.")
+	rootCmd.Flags().IntVar(&flags.maxAttempts, "max-attempts", crawler.DefaultBudget.MaxAttempts, "The maximum number of elements tried on a page before looking for clickable elements again.")
 	rootCmd.Flags().BoolVarP(&flags.debug, "debug", "d", false, "If specified the browser will not run in headless and auto open devtools.")
 	rootCmd.Flags().BoolVarP(&flags.saveResponses, "save-responses", "r", false, "If specified the HTTP responses will be saved when crawling.")
-	rootCmd.Flags().Var(&flags.logLevel, "log-level", "Minimum log level to output. Valid values: debug, info, warn, error.")
+	rootCmd.Flags().BoolVar(&flags.sourceMaps, "source-maps", false, "If specified the source maps of in scope scripts are downloaded and saved. "+
+		"Use the sourcemaps export command to reconstruct the original sources.")
+	rootCmd.Flags().BoolVar(&flags.domXss, "dom-xss", false, "If specified DOM XSS sinks are instrumented and values from sources reaching them are saved as findings. "+
+		"Direct calls to eval are made indirect by the instrumentation, which may break some pages.")
+	rootCmd.Flags().BoolVar(&flags.reflection, "reflection", false, "If specified the parameters found on each page are sent with unique canaries, "+
+		"as GET and POST, and where they are reflected in the responses and the rendered dom is saved.")
+	rootCmd.Flags().StringVar(&flags.scriptsDir, "scripts-dir", "", "Directory of javascript snippets evaluated on every page state, see scripts/ for an example. "+
+		"The findings they return are saved and the urls they return are crawled as new targets.")
+	rootCmd.Flags().StringVarP(&flags.output, "output", "o", "req.db", "The sqlite database file the crawl results are written to.")
+	rootCmd.Flags().StringArrayVarP(&flags.headers, "header", "H", nil, "Extra header sent with every request, e.g. for authentication: -H 'Authorization: Bearer ...'. "+
+		"This argument can be specified multiple times")
+	rootCmd.PersistentFlags().Var(&flags.logLevel, "log-level", "Minimum log level to output. Valid values: debug, info, warn, error.")
 	rootCmd.Flags().StringSliceVarP(&flags.scope, "scope", "s", nil, "The current browser url of the page being crawled must match one of these or a subdomain of them. "+
 		"E.g. example.com matches example.com and all subdomains to example.com. This argument can be specified multiple times")
+	rootCmd.Flags().IntVar(&flags.maxDepth, "max-depth", 0, "Urls found in the dom and in requests of a crawl are crawled as new targets up to this many levels deep. 0 only crawls the given targets. "+
+		"Without --scope only urls on the hosts of the given targets, and their subdomains, are crawled.")
+	rootCmd.Flags().IntVar(&flags.maxPagesPerHost, "max-pages-per-host", 50, "The maximum number of found urls crawled as targets per host. 0 means no limit.")
+	rootCmd.Flags().BoolVar(&flags.seed, "seed", false, "If specified robots.txt, sitemaps, security.txt and other well-known files of each target host are fetched and the "+
+		"in scope urls in them are crawled as targets as well.")
+	rootCmd.Flags().StringSliceVar(&flags.browserURLs, "browser-url", nil, "DevTools url of an externally managed browser to crawl with instead of launching local ones, e.g. ws://127.0.0.1:3000 for browserless "+
+		"or http://127.0.0.1:9222 for a chrome started with --remote-debugging-port. This argument can be specified multiple times")
+	rootCmd.Flags().IntVar(&flags.browserRetries, "browser-retries", 1, "How many times a target is crawled again with a new browser when the browser crashed or the connection to it was lost. 0 means never.")
+	rootCmd.Flags().StringVar(&flags.browserBin, "browser-bin", "", "Path to the chrome/chromium binary to launch. If empty the browser is looked up or downloaded.")
+	rootCmd.Flags().StringArrayVar(&flags.browserFlags, "browser-flag", nil, "Extra chromium command line flag given as name=value or just name, e.g. --browser-flag proxy-server=127.0.0.1:8080. "+
+		"This argument can be specified multiple times")
+	rootCmd.Flags().StringVar(&flags.device, "device", "laptop", "Device to emulate. Valid values: "+strings.Join(devicePresetNames(), ", ")+".")
+	rootCmd.Flags().StringVar(&flags.userAgent, "user-agent", "", "User agent to use instead of the one of the emulated device.")
+	rootCmd.Flags().StringVar(&flags.viewport, "viewport", "", "Viewport size given as WIDTHxHEIGHT to use instead of the one of the emulated device, e.g. 1920x1080.")
+	rootCmd.Flags().StringVar(&flags.timezone, "timezone", "", "IANA timezone the browser should be in, e.g. Europe/Stockholm.")
+	rootCmd.Flags().StringVar(&flags.geolocation, "geolocation", "", "Position reported by the geolocation api given as LATITUDE,LONGITUDE[,ACCURACY], e.g. 59.33,18.06.")
+	rootCmd.Flags().StringVar(&flags.acceptLanguage, "accept-language", "", "Accept-Language header to send, the first language is also used as the browser locale, e.g. sv-SE,sv;q=0.9.")
+	rootCmd.Flags().BoolVar(&flags.sharedSession, "shared-session", false, "If specified all targets crawled by a browser share cookies, storage and caches instead of each target getting a fresh browser context.")
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -101,7 +171,11 @@ func initConfig() {
 		viper.SetConfigName(".rod-crawler")
 	}
 
-	viper.AutomaticEnv() // read in environment variables that match
+	// read in environment variables that match, e.g. ROD_CRAWLER_SAVE_RESPONSES for --save-responses and
+	// ROD_CRAWLER_MINE_BATCH_SIZE for --batch-size of mine
+	viper.SetEnvPrefix("ROD_CRAWLER")
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_", ".", "_"))
+	viper.AutomaticEnv()
 
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
@@ -113,13 +187,25 @@ var rootCmd = &cobra.Command{
 	Use:   "rod-crawler",
 	Short: "A simplistic, headless and click-based depth first crawler",
 
+	//Runs for every subcommand as well, so they get their flags from the config file and environment too
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		err := applyConfig(cmd)
+		if err != nil {
+			return err
+		}
+		setupLogger()
+		return nil
+	},
+	PersistentPostRun: func(cmd *cobra.Command, args []string) {
+		_ = zap.L().Sync()
+	},
 	Run: func(cmd *cobra.Command, args []string) {
-		crawler()
+		crawl()
 	},
 }
 
-func crawler() {
-	//Setup logger
+// setupLogger replaces the global logger with one logging at --log-level
+func setupLogger() {
 	c := zap.NewDevelopmentConfig()
 	var level zapcore.Level
 	switch flags.logLevel {
@@ -135,81 +221,49 @@ func crawler() {
 		level = zapcore.InfoLevel
 	}
 	c.Level.SetLevel(level)
-	logger := zap.Must(c.Build())
-	defer logger.Sync()
-	zap.ReplaceGlobals(logger)
+	zap.ReplaceGlobals(zap.Must(c.Build()))
+}
+
+func crawl() {
+	device, err := browserDevice()
+	if err != nil {
+		zap.L().Fatal("invalid browser options", zap.Error(err))
+	}
+	emulation, err := browserEmulation()
+	if err != nil {
+		zap.L().Fatal("invalid browser options", zap.Error(err))
+	}
+	budget, err := crawlBudget()
+	if err != nil {
+		zap.L().Fatal("invalid budget", zap.Error(err))
+	}
 
 	// Headless runs the browser on foreground, you can also use flag "-rod=show"
 	// Devtools opens the tab in each new tab opened automatically
+	var browsers crawler.BrowserFactory = crawler.LocalBrowsers{Launcher: newLauncher}
+	if len(flags.browserURLs) != 0 {
+		browsers = &crawler.RemoteBrowsers{Urls: flags.browserURLs}
+	}
 
-	bPool := rod.NewBrowserPool(flags.concurrency)
-	fCreateBrowser := func() *rod.Browser {
-		l := launcher.New().
-			Headless(!flags.debug).
-			Devtools(flags.debug)
-		url := l.MustLaunch()
-		go l.Cleanup()
-
-		// Trace shows verbose debug information for each action executed
-		// SlowMotion is a debug related function that waits 2 seconds between
-		// each action, making it easier to inspect what your code is doing.
-		browser := rod.New().
-			ControlURL(url).
-			//Trace(true).
-			//SlowMotion(1 * time.Second).
-			MustConnect().
-			MustIgnoreCertErrors(true)
-
-		//Don't download files in the browser, e.g. pdf files
-		proto.BrowserSetDownloadBehavior{
-			Behavior:         proto.BrowserSetDownloadBehaviorBehaviorDeny,
-			BrowserContextID: browser.BrowserContextID,
-		}.Call(browser)
-
-		//Avoid alerts and close tabs
-		go browser.EachEvent(func(e *proto.PageJavascriptDialogOpening) {
-			_ = proto.PageHandleJavaScriptDialog{Accept: false, PromptText: ""}.Call(browser)
-		},
-			func(e *proto.PageWindowOpen) {
-				zap.L().Info("new tab opened, trying to close it", zap.String("url", e.URL))
-				time.Sleep(time.Millisecond * 500)
-				pages, err := browser.Pages()
-				if err != nil {
-					zap.L().Error("failed getting pages in tab closer", zap.Error(err))
-					return
-				}
-				for _, page := range pages {
-					info, err := page.Info()
-					if err != nil {
-						zap.L().Error("failed getting page info in tab closer", zap.Error(err))
-						return
-					}
-					if info.URL == e.URL {
-						err = page.Close()
-						if err != nil {
-							zap.L().Error("failed closing page in tab closer", zap.Error(err))
-							return
-						}
-					}
-				}
-			},
-		)()
-
-		// go func() {
-		// 	for event := range browser.Event() {
-		// 		log.Printf("event: %s", event.Method)
-		// 	}
-		// }()
-
-		return browser
+	snippets := []crawler.Snippet{}
+	if flags.scriptsDir != "" {
+		snippets, err = crawler.LoadSnippets(flags.scriptsDir)
+		if err != nil {
+			zap.L().Fatal("failed loading snippets", zap.Error(err), zap.String("dir", flags.scriptsDir))
+		}
+		zap.L().Info("loaded snippets", zap.Int("snippets", len(snippets)))
 	}
 
-	defer bPool.Cleanup(func(browser *rod.Browser) {
-		browser.MustClose()
-	})
+	headers, err := parseHeaders(flags.headers)
+	if err != nil {
+		zap.L().Fatal("invalid header", zap.Error(err))
+	}
 
-	outputHandler := sqlite.SqliteOutput{Database: "req.db"}
-	outputHandler.Init()
+	outputHandler := crawler.SqliteOutput{Database: flags.output}
+	err = outputHandler.Init()
+	if err != nil {
+		zap.L().Fatal("failed opening output database", zap.Error(err), zap.String("database", flags.output))
+	}
 	defer outputHandler.Cleanup()
 
 	// ServeMonitor plays screenshots of each tab. This feature is extremely
@@ -230,8 +284,7 @@ func crawler() {
 			sc = bufio.NewScanner(f)
 		}
 		for sc.Scan() {
-			target := strings.ToLower(sc.Text())
-			targets <- target
+			targets <- strings.ToLower(sc.Text())
 		}
 		if sc.Err() != nil {
 			panic(sc.Err())
@@ -239,34 +292,89 @@ func crawler() {
 		close(targets)
 	}()
 
-	wg := sync.WaitGroup{}
-	for i := 0; i < flags.concurrency; i++ {
-		wg.Add(1)
-		go func() {
-			for target := range targets {
-				browser := bPool.Get(fCreateBrowser)
-				j := crawl.Job{Browser: browser, Target: target, Scope: flags.scope,
-					CrawlTimeout: time.Second * time.Duration(flags.perCrawltargetTimeout), OutputHandler: &outputHandler}
-				j.Crawl(flags.saveResponses)
-				//Cleanup tabs in the browser for the next user
-				pages, err := browser.Pages()
-				//Keep a blank page to not close the browser
-				browser.Page(proto.TargetCreateTarget{URL: ""})
-				if err != nil {
-					zap.L().Error("failed getting pages to cleanup tabs", zap.Error(err))
-					bPool.Put(fCreateBrowser())
-					continue
-				}
-				for _, p := range pages {
-					p.Close()
-				}
-
-				bPool.Put(browser)
-			}
-			wg.Done()
-		}()
+	cr := crawler.New(crawler.Options{
+		Scope:           flags.scope,
+		Concurrency:     flags.concurrency,
+		TargetTimeout:   time.Second * time.Duration(flags.perCrawltargetTimeout),
+		Budget:          budget,
+		Outputs:         []crawler.Output{&outputHandler},
+		Browsers:        browsers,
+		BrowserRetries:  flags.browserRetries,
+		Device:          device,
+		Emulation:       emulation,
+		Headers:         headers,
+		SharedSession:   flags.sharedSession,
+		MaxDepth:        flags.maxDepth,
+		MaxPagesPerHost: flags.maxPagesPerHost,
+		Seed:            flags.seed,
+		SaveResponses:   flags.saveResponses,
+		SourceMaps:      flags.sourceMaps,
+		DomXss:          flags.domXss,
+		Reflection:      flags.reflection,
+		Snippets:        snippets,
+		Hooks:           Hooks,
+	})
+	//The first interrupt stops the crawl and saves what has been found, a second one kills it
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, stop)
+
+	err = cr.Run(ctx, targets)
+	if err != nil {
+		zap.L().Error("crawling stopped", zap.Error(err))
+	}
+	printSummary(os.Stderr, cr.Results())
+}
+
+// parseHeaders parses headers given as 'name: value'
+func parseHeaders(raw []string) (map[string]string, error) {
+	headers := map[string]string{}
+	for _, h := range raw {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok {
+			return nil, fmt.Errorf("header must be given as 'name: value': %q", h)
+		}
+		headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
+
+// crawlBudget is the budget given by the flags. The crawler replaces zero values with the defaults, so they are rejected
+// here rather than silently ignored.
+func crawlBudget() (crawler.Budget, error) {
+	for _, f := range []struct {
+		name  string
+		value time.Duration
+	}{{"navigation-timeout", flags.navigationTimeout}, {"navigation-backoff", flags.navigationBackoff},
+		{"stability-wait", flags.stabilityWait}, {"click-timeout", flags.clickTimeout}} {
+		if f.value <= 0 {
+			return crawler.Budget{}, fmt.Errorf("--%s must be greater than 0, got %s", f.name, f.value)
+		}
+	}
+	if flags.maxActions <= 0 {
+		return crawler.Budget{}, fmt.Errorf("--max-actions must be greater than 0, got %d", flags.maxActions)
+	}
+	if flags.maxAttempts <= 0 {
+		return crawler.Budget{}, fmt.Errorf("--max-attempts must be greater than 0, got %d", flags.maxAttempts)
+	}
+	if flags.maxPageStates < 0 {
+		return crawler.Budget{}, fmt.Errorf("--max-page-states must not be negative, got %d", flags.maxPageStates)
+	}
+
+	//0 retries means the default in a budget
+	retries := flags.navigationRetries
+	if retries <= 0 {
+		retries = -1
 	}
-	wg.Wait()
 
-	zap.L().Info("all crawling done")
+	return crawler.Budget{
+		NavigationTimeout: flags.navigationTimeout,
+		NavigationRetries: retries,
+		NavigationBackoff: flags.navigationBackoff,
+		StabilityWait:     flags.stabilityWait,
+		ClickTimeout:      flags.clickTimeout,
+		MaxActions:        flags.maxActions,
+		MaxPageStates:     flags.maxPageStates,
+		MaxAttempts:       flags.maxAttempts,
+	}, nil
 }
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/AlfredBerg/rod-crawler/internal/outputHandlers/sqlite"
+	"github.com/AlfredBerg/rod-crawler/internal/sourcemap"
+	"github.com/spf13/cobra"
+)
+
+var sourceMapsExportFlags struct {
+	database string
+	out      string
+}
+
+var sourceMapsCmd = &cobra.Command{
+	Use:   "sourcemaps",
+	Short: "Work with the source maps saved when crawling with --source-maps",
+}
+
+var sourceMapsExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Reconstruct the original sources of the saved source maps into a directory, one sub directory per host",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		maps, files := 0, 0
+		err := sqlite.ReadSourceMaps(sourceMapsExportFlags.database, func(script, mapURL, content string) error {
+			m, err := sourcemap.Parse(content)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "skipping invalid source map", mapURL, err)
+				return nil
+			}
+
+			//Inlined data url source maps have no host of their own
+			host := "unknown"
+			if u, err := url.Parse(script); err == nil && u.Host != "" {
+				host = u.Host
+			}
+
+			written, err := m.Export(filepath.Join(sourceMapsExportFlags.out, host))
+			if err != nil {
+				return err
+			}
+			maps++
+			files += written
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "Exported %d files from %d source maps to %s\n", files, maps, sourceMapsExportFlags.out)
+		return nil
+	},
+}
+
+func init() {
+	sourceMapsExportCmd.Flags().StringVar(&sourceMapsExportFlags.database, "db", "req.db", "The sqlite database file written by the crawl.")
+	sourceMapsExportCmd.Flags().StringVar(&sourceMapsExportFlags.out, "out", "sources", "The directory to write the sources to.")
+	sourceMapsCmd.AddCommand(sourceMapsExportCmd)
+	rootCmd.AddCommand(sourceMapsCmd)
+}
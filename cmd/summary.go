@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/AlfredBerg/rod-crawler/crawler"
+)
+
+// printSummary writes a table with the status and coverage metrics of every crawled target and the totals
+func printSummary(w io.Writer, results []crawler.Result) {
+	if len(results) == 0 {
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TARGET\tSTATUS\tSTOP\tTIME\tSTATES\tURLS\tENDPOINTS\tCLICKED/FOUND\tINVISIBLE\tREQUESTS\tHOSTS")
+
+	var total crawler.Metrics
+	var duration time.Duration
+	failed := 0
+	hosts := map[string]bool{}
+	for _, r := range results {
+		m := r.Metrics
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%d\t%d\t%d/%d\t%d\t%d\t%d\n", r.Target, r.Status, r.StopReason, r.Duration.Round(time.Second), m.PageStates,
+			m.UniqueUrls, m.Endpoints, m.ElementsClicked, m.ElementsDiscovered, m.ElementsInvisible, m.Requests, len(m.RequestsPerHost))
+
+		if r.Status != crawler.StatusDone {
+			failed++
+		}
+		duration += r.Duration
+		total.PageStates += m.PageStates
+		total.UniqueUrls += m.UniqueUrls
+		total.Endpoints += m.Endpoints
+		total.ElementsClicked += m.ElementsClicked
+		total.ElementsDiscovered += m.ElementsDiscovered
+		total.ElementsInvisible += m.ElementsInvisible
+		total.Requests += m.Requests
+		for h := range m.RequestsPerHost {
+			hosts[h] = true
+		}
+	}
+	fmt.Fprintf(tw, "%d targets\t%d not done\t\t%s\t%d\t%d\t%d\t%d/%d\t%d\t%d\t%d\n", len(results), failed, duration.Round(time.Second), total.PageStates,
+		total.UniqueUrls, total.Endpoints, total.ElementsClicked, total.ElementsDiscovered, total.ElementsInvisible, total.Requests, len(hosts))
+	tw.Flush()
+}
@@ -0,0 +1,193 @@
+package crawler
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/AlfredBerg/rod-crawler/internal/metrics"
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/launcher"
+	"github.com/go-rod/rod/lib/proto"
+	"go.uber.org/zap"
+)
+
+// BrowserFactory creates the browsers the targets are crawled with, and closes them when the crawler is done with them
+type BrowserFactory interface {
+	Create() (*rod.Browser, error)
+	Close(browser *rod.Browser) error
+}
+
+// LocalBrowsers launches a local chromium for every browser
+type LocalBrowsers struct {
+	//Creates the launcher of each browser, e.g. to set the binary or flags. A headless default launcher is used if nil.
+	Launcher func() *launcher.Launcher
+}
+
+func (l LocalBrowsers) Create() (*rod.Browser, error) {
+	ln := launcher.New()
+	if l.Launcher != nil {
+		ln = l.Launcher()
+	}
+	u, err := ln.Launch()
+	if err != nil {
+		return nil, err
+	}
+
+	// Trace(true) shows verbose debug information for each action executed and
+	// SlowMotion(time.Second) waits between each action, making it easier to inspect what the crawler is doing
+	browser := rod.New().ControlURL(u)
+	err = browser.Connect()
+	if err != nil {
+		ln.Kill()
+		ln.Cleanup()
+		return nil, err
+	}
+	//Removes the user data dir when the browser exits
+	go ln.Cleanup()
+	return browser, nil
+}
+
+func (l LocalBrowsers) Close(browser *rod.Browser) error {
+	return browser.Close()
+}
+
+// RemoteBrowsers hands out connections to externally managed browsers, e.g. a browser farm running in containers.
+// The urls are used round robin so the load is spread over all of them. The browsers are never closed, they are
+// managed by someone else.
+type RemoteBrowsers struct {
+	//DevTools urls, e.g. ws://127.0.0.1:3000 for browserless or http://127.0.0.1:9222 for a chrome started with --remote-debugging-port
+	Urls []string
+	next uint32
+}
+
+// Create tries the remote browsers in turn until one of them accepts a connection.
+// All urls are tried a few times with a backoff before giving up, the error has the last error of each url.
+func (r *RemoteBrowsers) Create() (*rod.Browser, error) {
+	if len(r.Urls) == 0 {
+		return nil, errors.New("no remote browser urls given")
+	}
+
+	failed := map[string]error{}
+	backoff := time.Second
+	for attempt := 0; attempt < len(r.Urls)*3; attempt++ {
+		u := r.Urls[int(atomic.AddUint32(&r.next, 1)-1)%len(r.Urls)]
+
+		browser, err := connectRemote(u)
+		if err == nil {
+			return browser, nil
+		}
+		failed[u] = fmt.Errorf("%s: %w", u, err)
+
+		// Only back off when all urls have failed in this round
+		if (attempt+1)%len(r.Urls) == 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	errs := []error{}
+	for _, u := range r.Urls {
+		errs = append(errs, failed[u])
+	}
+	return nil, fmt.Errorf("no remote browser could be connected to: %w", errors.Join(errs...))
+}
+
+func (r *RemoteBrowsers) Close(browser *rod.Browser) error {
+	return nil
+}
+
+func connectRemote(u string) (*rod.Browser, error) {
+	controlURL := u
+	// ws urls are used as is, this is what e.g. browserless expects. Everything else is
+	// resolved to the websocket debugger url through the /json/version endpoint.
+	if !strings.HasPrefix(u, "ws://") && !strings.HasPrefix(u, "wss://") {
+		var err error
+		controlURL, err = launcher.ResolveURL(u)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	browser := rod.New().ControlURL(controlURL)
+	err := browser.Connect()
+	if err != nil {
+		return nil, err
+	}
+	return browser, nil
+}
+
+// setupBrowser prepares a newly created browser for crawling
+func (c *Crawler) setupBrowser(browser *rod.Browser) error {
+	err := browser.IgnoreCertErrors(true)
+	if err != nil {
+		return err
+	}
+	browser.DefaultDevice(c.opts.Device)
+
+	c.denyDownloads(browser)
+
+	if c.opts.Hooks != nil {
+		c.opts.Hooks.OnBrowserCreated(browser)
+	}
+
+	//Avoid alerts and close tabs
+	go browser.EachEvent(func(e *proto.PageJavascriptDialogOpening) {
+		_ = proto.PageHandleJavaScriptDialog{Accept: false, PromptText: ""}.Call(browser)
+	},
+		func(e *proto.PageWindowOpen) {
+			c.opts.Logger.Info("new tab opened, trying to close it", zap.String("url", e.URL))
+			time.Sleep(time.Millisecond * 500)
+			pages, err := browser.Pages()
+			if err != nil {
+				c.opts.Logger.Error("failed getting pages in tab closer", zap.Error(err))
+				return
+			}
+			for _, page := range pages {
+				info, err := page.Info()
+				if err != nil {
+					c.opts.Logger.Error("failed getting page info in tab closer", zap.Error(err))
+					return
+				}
+				if info.URL == e.URL {
+					err = page.Close()
+					if err != nil {
+						c.opts.Logger.Error("failed closing page in tab closer", zap.Error(err))
+						return
+					}
+				}
+			}
+		},
+	)()
+
+	// go func() {
+	// 	for event := range browser.Event() {
+	// 		log.Printf("event: %s", event.Method)
+	// 	}
+	// }()
+
+	return nil
+}
+
+// browserAlive checks that the browser still answers on the devtools connection
+func browserAlive(browser *rod.Browser) bool {
+	_, err := proto.BrowserGetVersion{}.Call(browser.Timeout(time.Second * 5))
+	return err == nil
+}
+
+// browserLost tells if the crawl stopped because the browser or its tab crashed or could not be used
+func browserLost(res Result) bool {
+	return res.StopReason == metrics.StopBrowserCrashed || res.StopReason == metrics.StopBrowserFailed
+}
+
+// denyDownloads stops the browser context from downloading files, e.g. pdf files
+func (c *Crawler) denyDownloads(browser *rod.Browser) {
+	err := proto.BrowserSetDownloadBehavior{
+		Behavior:         proto.BrowserSetDownloadBehaviorBehaviorDeny,
+		BrowserContextID: browser.BrowserContextID,
+	}.Call(browser)
+	if err != nil {
+		c.opts.Logger.Error("failed setting download behavior", zap.Error(err))
+	}
+}
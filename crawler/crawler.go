@@ -0,0 +1,387 @@
+// Package crawler crawls web applications by clicking around in a browser and saves the traffic and everything found
+// on the way. It is what the rod-crawler command line tool is built on, and can be embedded in other programs.
+package crawler
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AlfredBerg/rod-crawler/hooks"
+	"github.com/AlfredBerg/rod-crawler/internal/crawl"
+	"github.com/AlfredBerg/rod-crawler/internal/frontier"
+	"github.com/AlfredBerg/rod-crawler/internal/metrics"
+	"github.com/AlfredBerg/rod-crawler/internal/params"
+	"github.com/AlfredBerg/rod-crawler/internal/seed"
+	"github.com/AlfredBerg/rod-crawler/internal/sourcemap"
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/devices"
+	"go.uber.org/zap"
+)
+
+// Options configure a Crawler, the zero value of every option is a sensible default
+type Options struct {
+	//The current browser url of the page being crawled must match one of these or a subdomain of them
+	Scope []string
+	//The number of browsers crawling at the same time, 2 if not set
+	Concurrency int
+	//The maximum time spent on one target, 60 seconds if not set
+	TargetTimeout time.Duration
+	//Limits the time and actions spent on one target within the target timeout
+	Budget Budget
+
+	//Everything found is saved to all of the outputs
+	Outputs []Output
+	//Creates the browsers, local headless chromium if nil
+	Browsers BrowserFactory
+	//How many times a target is crawled again with a new browser when the browser crashed or the connection to it was lost, 0 means never
+	BrowserRetries int
+	//Used for the logs of the crawler and its jobs, the global logger at the time of New is used if nil
+	Logger *zap.Logger
+	//Receives the events of the crawl, it must be read from until Run returns. Nil disables events.
+	Events chan<- Event
+
+	//The device every tab emulates, a laptop if not set
+	Device    devices.Device
+	Emulation Emulation
+	//Extra headers sent with every request, e.g. for authentication
+	Headers map[string]string
+	//Crawl all targets in the same browser context of each browser instead of a fresh context per target
+	SharedSession bool
+
+	//Urls found while crawling are crawled as new targets up to this many levels deep, 0 only crawls the given targets.
+	//Without a Scope only the urls on the hosts of the given targets and their subdomains are crawled.
+	MaxDepth int
+	//The maximum number of found urls crawled per host, 0 means no limit
+	MaxPagesPerHost int
+	//Also crawl the in scope urls in robots.txt, sitemaps and other well-known files of each target host
+	Seed bool
+
+	//Load and save the responses, otherwise only requests are saved
+	SaveResponses bool
+	//Download and save the source maps of in scope scripts
+	SourceMaps bool
+	//Trace values from DOM XSS sources reaching sinks and save them as findings
+	DomXss bool
+	//Send the parameters of each page state with canaries and save where they are reflected
+	Reflection bool
+	//Evaluated on every page state
+	Snippets []Snippet
+	Hooks    hooks.Hooks
+}
+
+// EventKind is what an Event is about
+type EventKind string
+
+const (
+	EventTargetStarted EventKind = "target-started"
+	EventTargetDone    EventKind = "target-done"
+	EventFinding       EventKind = "finding"
+)
+
+// Event is sent on Options.Events while crawling
+type Event struct {
+	Kind EventKind
+	//The target being crawled, empty for findings
+	Target string
+	//How many crawls deep the target was found, 0 for the given targets
+	Depth int
+	//Set for EventFinding
+	Finding *Finding
+	//Set for EventTargetDone
+	Result *Result
+	Time   time.Time
+}
+
+// Finding is something found while crawling, e.g. a DOM XSS sink hit or the result of a snippet
+type Finding struct {
+	//What found it, e.g. dom-xss or snippet:<name>
+	Type string
+	//The page state it was found on
+	Origin string
+	Title  string
+	//json
+	Detail string
+}
+
+type Crawler struct {
+	opts Options
+
+	lock    sync.Mutex
+	results []Result
+}
+
+func New(opts Options) *Crawler {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 2
+	}
+	if opts.TargetTimeout <= 0 {
+		opts.TargetTimeout = time.Second * 60
+	}
+	if opts.Browsers == nil {
+		opts.Browsers = LocalBrowsers{}
+	}
+	if opts.Logger == nil {
+		opts.Logger = zap.L()
+	}
+	if opts.Device.Title == "" {
+		opts.Device = devices.LaptopWithMDPIScreen.Landscape()
+	}
+	return &Crawler{opts: opts}
+}
+
+// run is the state shared by all jobs of one Run
+type run struct {
+	ctx        context.Context
+	output     *outputs
+	frontier   *frontier.Frontier
+	params     *params.Inventory
+	sourceMaps *sourcemap.Fetcher
+	pool       rod.BrowserPool
+}
+
+// Run crawls the targets and the urls found from them until the targets channel is closed and everything is crawled.
+// When ctx is canceled no new targets are started and the running ones are stopped.
+func (c *Crawler) Run(ctx context.Context, targets <-chan string) error {
+	r := &run{
+		ctx: ctx,
+		// Targets from the input are seeds of the frontier, urls found while crawling are added to it as well
+		frontier: frontier.New(c.opts.Scope, c.opts.MaxDepth, c.opts.MaxPagesPerHost),
+		params:   params.NewInventory(),
+		pool:     rod.NewBrowserPool(c.opts.Concurrency),
+	}
+	c.lock.Lock()
+	c.results = nil
+	c.lock.Unlock()
+
+	r.output = &outputs{outputs: c.opts.Outputs, emit: func(e Event) { c.emit(ctx, e) }}
+	if c.opts.SourceMaps {
+		r.sourceMaps = sourcemap.NewFetcher(c.opts.Headers)
+	}
+
+	stop := context.AfterFunc(ctx, r.frontier.Stop)
+	defer stop()
+
+	seeding := make(chan struct{})
+	go func() {
+		c.seed(r, targets)
+		close(seeding)
+	}()
+
+	queue := make(chan frontier.Target)
+	go func() {
+		for {
+			target, ok := r.frontier.Next()
+			if !ok {
+				close(queue)
+				return
+			}
+			queue <- target
+		}
+	}()
+
+	defer r.pool.Cleanup(func(browser *rod.Browser) {
+		err := c.opts.Browsers.Close(browser)
+		if err != nil {
+			c.opts.Logger.Error("failed closing browser", zap.Error(err))
+		}
+	})
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < c.opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			for target := range queue {
+				c.crawl(r, target)
+				r.frontier.Done()
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	//The seeding must not add anything to the outputs after Run returns
+	<-seeding
+
+	c.opts.Logger.Info("all crawling done")
+	return ctx.Err()
+}
+
+// seed adds the targets to the frontier, together with the urls found by seeding them
+func (c *Crawler) seed(r *run, targets <-chan string) {
+	var seeder *seed.Seeder
+	if c.opts.Seed {
+		seeder = seed.New(c.opts.Headers)
+		seeder.Scope = c.opts.Scope
+		seeder.Logger = c.opts.Logger
+	}
+
+	seeding := sync.WaitGroup{}
+	seedingLimit := make(chan struct{}, c.opts.Concurrency)
+	for done := false; !done; {
+		select {
+		case <-r.ctx.Done():
+			done = true
+		case target, ok := <-targets:
+			if !ok {
+				done = true
+				break
+			}
+			if !r.frontier.Seed(target) {
+				c.opts.Logger.Warn("skipping invalid or duplicate target", zap.String("target", target))
+				continue
+			}
+
+			if seeder != nil {
+				seeding.Add(1)
+				seedingLimit <- struct{}{}
+				go func() {
+					for _, u := range seeder.Seed(r.ctx, target) {
+						if r.frontier.Add(frontier.Target{Url: u.Url, Source: u.Source}) {
+							r.output.HandleSeed(u.Url, u.Source, target)
+						}
+					}
+					<-seedingLimit
+					seeding.Done()
+				}()
+			}
+		}
+	}
+	//Seeding adds targets, so it must be done before the frontier is told there are no more seeds
+	seeding.Wait()
+	r.frontier.CloseSeeds()
+}
+
+// crawl crawls one target, again with a new browser if the browser was lost while crawling it
+func (c *Crawler) crawl(r *run, target frontier.Target) {
+	for attempt := 1; ; attempt++ {
+		res := c.crawlOnce(r, target, attempt)
+		if !browserLost(res) || attempt > c.opts.BrowserRetries || r.ctx.Err() != nil {
+			c.done(r, res)
+			return
+		}
+		c.opts.Logger.Warn("browser was lost, crawling the target again", zap.String("target", target.Url), zap.Int("attempt", attempt+1))
+	}
+}
+
+// crawlOnce crawls one target with a browser from the pool
+func (c *Crawler) crawlOnce(r *run, target frontier.Target, attempt int) Result {
+	browser := r.pool.Get(func() *rod.Browser { return nil })
+	//A browser in the pool may have crashed or a remote browser may have gone away since it was last used
+	if browser != nil && !browserAlive(browser) {
+		c.opts.Logger.Warn("browser is not responding, replacing it")
+		c.opts.Browsers.Close(browser)
+		browser = nil
+	}
+	if browser == nil {
+		var err error
+		browser, err = c.newBrowser()
+		if err != nil {
+			c.opts.Logger.Error("failed creating browser, skipping target", zap.Error(err), zap.String("target", target.Url))
+			r.pool.Put(nil)
+			return Result{Target: target.Url, Depth: target.Depth, Attempt: attempt, Status: metrics.StatusFailed, StopReason: metrics.StopBrowserFailed,
+				Error: err.Error(), Started: time.Now()}
+		}
+	}
+
+	// Every target gets a fresh browser context so cookies, storage, caches and service workers
+	// don't leak from one target to the next, unless the session is intentionally shared
+	jobBrowser := browser
+	if !c.opts.SharedSession {
+		incognito, err := browser.Incognito()
+		if err != nil {
+			c.opts.Logger.Error("failed creating browser context, crawling in the shared context", zap.Error(err), zap.String("target", target.Url))
+		} else {
+			jobBrowser = incognito
+			c.denyDownloads(jobBrowser)
+		}
+	}
+
+	c.emit(r.ctx, Event{Kind: EventTargetStarted, Target: target.Url, Depth: target.Depth})
+	j := crawl.Job{Browser: jobBrowser, Target: target.Url, Depth: target.Depth, Attempt: attempt, Frontier: r.frontier, Params: r.params, SourceMaps: r.sourceMaps,
+		Scope: c.opts.Scope, CrawlTimeout: c.opts.TargetTimeout, Budget: c.opts.Budget, OutputHandler: r.output, Emulation: c.opts.Emulation, Headers: c.opts.Headers,
+		DomXss: c.opts.DomXss, Reflection: c.opts.Reflection, Snippets: c.opts.Snippets, Hooks: c.opts.Hooks,
+		Logger: c.opts.Logger}
+	res := j.Crawl(r.ctx, c.opts.SaveResponses)
+
+	//Only the tab may have crashed, the browser is replaced if it is gone as well
+	if browserLost(res) && !browserAlive(browser) {
+		c.opts.Logger.Warn("browser is not responding after crawling, replacing it", zap.String("target", target.Url))
+		c.opts.Browsers.Close(browser)
+		r.pool.Put(nil)
+		return res
+	}
+
+	//Disposing the context also closes all tabs that were opened in it, in a shared session the job closes the tabs it opened
+	if jobBrowser != browser {
+		err := jobBrowser.Close()
+		if err != nil {
+			c.opts.Logger.Error("failed disposing browser context, replacing the browser", zap.Error(err))
+			c.opts.Browsers.Close(browser)
+			r.pool.Put(nil)
+			return res
+		}
+	}
+
+	r.pool.Put(browser)
+	return res
+}
+
+// Results returns the results of the targets crawled by the last Run, in the order they were done
+func (c *Crawler) Results() []Result {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]Result{}, c.results...)
+}
+
+// done saves the result of the last attempt to crawl a target
+func (c *Crawler) done(r *run, res Result) {
+	err := r.output.HandleResult(res)
+	if err != nil {
+		c.opts.Logger.Error("failed saving result", zap.Error(err), zap.String("target", res.Target))
+	}
+	if c.opts.Hooks != nil {
+		c.opts.Hooks.OnJobDone(res.Target)
+	}
+
+	c.lock.Lock()
+	c.results = append(c.results, res)
+	c.lock.Unlock()
+	c.emit(r.ctx, Event{Kind: EventTargetDone, Target: res.Target, Depth: res.Depth, Result: &res})
+}
+
+func (c *Crawler) newBrowser() (*rod.Browser, error) {
+	browser, err := c.opts.Browsers.Create()
+	if err != nil {
+		return nil, err
+	}
+	err = c.setupBrowser(browser)
+	if err != nil {
+		c.opts.Browsers.Close(browser)
+		return nil, err
+	}
+	c.opts.Logger.Debug("created browser")
+	return browser, nil
+}
+
+// emit sends an event if events are enabled, it gives up when ctx is canceled
+func (c *Crawler) emit(ctx context.Context, e Event) {
+	if c.opts.Events == nil {
+		return
+	}
+	e.Time = time.Now()
+	select {
+	case c.opts.Events <- e:
+	case <-ctx.Done():
+	}
+}
+
+// Targets returns a closed channel with the targets, for calling Run with a fixed list of targets
+func Targets(targets ...string) <-chan string {
+	ch := make(chan string, len(targets))
+	for _, t := range targets {
+		ch <- strings.TrimSpace(t)
+	}
+	close(ch)
+	return ch
+}
@@ -0,0 +1,140 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AlfredBerg/rod-crawler/hooks"
+	"github.com/AlfredBerg/rod-crawler/internal/fixture"
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/launcher"
+)
+
+// countingBrowsers launches local browsers and counts them
+type countingBrowsers struct {
+	LocalBrowsers
+	created atomic.Int32
+}
+
+func (b *countingBrowsers) Create() (*rod.Browser, error) {
+	b.created.Add(1)
+	return b.LocalBrowsers.Create()
+}
+
+// killFirstBrowser closes the first browser while its first target is crawled
+type killFirstBrowser struct {
+	hooks.NoopHooks
+	lock   sync.Mutex
+	first  *rod.Browser
+	killed bool
+	done   int
+}
+
+func (k *killFirstBrowser) OnBrowserCreated(browser *rod.Browser) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	if k.first == nil {
+		k.first = browser
+	}
+}
+
+func (k *killFirstBrowser) OnPageState(page *rod.Page, state string) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	if !k.killed {
+		k.killed = true
+		_ = k.first.Close()
+	}
+}
+
+func (k *killFirstBrowser) OnJobDone(target string) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	k.done++
+}
+
+func TestRunReplacesLostBrowser(t *testing.T) {
+	bin, found := launcher.LookPath()
+	if !found {
+		t.Skip("no chromium installed")
+	}
+
+	site := fixture.New()
+	defer site.Close()
+
+	browsers := &countingBrowsers{LocalBrowsers: LocalBrowsers{Launcher: func() *launcher.Launcher { return launcher.New().Bin(bin).Headless(true) }}}
+	h := &killFirstBrowser{}
+	c := New(Options{Scope: []string{"127.0.0.1"}, Concurrency: 1, Browsers: browsers, BrowserRetries: 1, Hooks: h,
+		Budget: Budget{MaxActions: 5}})
+	err := c.Run(context.Background(), Targets(site.URL("/links")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := browsers.created.Load(); n != 2 {
+		t.Errorf("%d browsers were created, want the lost one to be replaced", n)
+	}
+	results := c.Results()
+	if len(results) != 1 {
+		t.Fatalf("got %d results, want one for the target", len(results))
+	}
+	if r := results[0]; r.Attempt != 2 || r.Status != StatusDone {
+		t.Errorf("attempt %d is %q (%s: %s), want the second attempt to be done", r.Attempt, r.Status, r.StopReason, r.Error)
+	}
+	if h.done != 1 {
+		t.Errorf("OnJobDone was called %d times, want once", h.done)
+	}
+}
+
+// noBrowsers fails to create every browser
+type noBrowsers struct{}
+
+func (noBrowsers) Create() (*rod.Browser, error)    { return nil, errors.New("no browsers") }
+func (noBrowsers) Close(browser *rod.Browser) error { return nil }
+
+// resultOutput only takes results, any other output panics as Output is nil
+type resultOutput struct {
+	Output
+}
+
+func (resultOutput) HandleResult(r Result) error { return nil }
+
+func TestRunWaitsForSeedingWhenCanceled(t *testing.T) {
+	requested := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		requested <- struct{}{}
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	//Never closed, so only the cancel stops the run
+	targets := make(chan string, 1)
+	targets <- server.URL + "/"
+
+	c := New(Options{Concurrency: 1, Browsers: noBrowsers{}, Outputs: []Output{resultOutput{}}, Seed: true})
+	done := make(chan error)
+	go func() { done <- c.Run(ctx, targets) }()
+
+	<-requested
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Run returned %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("Run did not return after the seeding was canceled")
+	}
+}
@@ -0,0 +1,131 @@
+package crawler
+
+import (
+	"errors"
+	"time"
+
+	"github.com/AlfredBerg/rod-crawler/internal/crawl"
+	"github.com/AlfredBerg/rod-crawler/internal/js"
+	"github.com/AlfredBerg/rod-crawler/internal/metrics"
+	"github.com/AlfredBerg/rod-crawler/internal/outputHandlers/sqlite"
+	"github.com/AlfredBerg/rod-crawler/internal/params"
+)
+
+// Output is where everything found while crawling is saved
+type Output = crawl.Output
+
+// SqliteOutput saves everything in a sqlite database, Init must be called before crawling and Cleanup when done
+type SqliteOutput = sqlite.SqliteOutput
+
+// Parameter is an entry of the parameter inventory given to Output.HandleParameter
+type Parameter = params.Parameter
+
+// Metrics measure how well a target was crawled
+type Metrics = metrics.Metrics
+
+// Result of the crawl of one target, the status is done, failed or canceled
+type Result = metrics.Result
+
+// The status of a Result
+const (
+	StatusDone     = metrics.StatusDone
+	StatusFailed   = metrics.StatusFailed
+	StatusCanceled = metrics.StatusCanceled
+)
+
+// Emulation overrides applied to every crawling tab
+type Emulation = crawl.Emulation
+
+// Budget limits the time and the actions spent on one target, see DefaultBudget for the defaults
+type Budget = crawl.Budget
+
+// DefaultBudget is used for the zero values of a Budget
+var DefaultBudget = crawl.DefaultBudget
+
+// Snippet is a user provided script evaluated on every page state
+type Snippet = js.Snippet
+
+// LoadSnippets reads the .js files in dir as snippets
+func LoadSnippets(dir string) ([]Snippet, error) {
+	return js.LoadSnippets(dir)
+}
+
+// outputs sends everything to all outputs of the crawler, and findings to the events as well
+type outputs struct {
+	outputs []Output
+	emit    func(Event)
+}
+
+func (o *outputs) each(fn func(Output) error) error {
+	errs := []error{}
+	for _, out := range o.outputs {
+		errs = append(errs, fn(out))
+	}
+	return errors.Join(errs...)
+}
+
+func (o *outputs) HandleRequest(transactionIdentifier, origin, method, body, url, path, raw, host string, headers map[string][]string) error {
+	return o.each(func(out Output) error {
+		return out.HandleRequest(transactionIdentifier, origin, method, body, url, path, raw, host, headers)
+	})
+}
+
+func (o *outputs) HandleResponse(transactionIdentifier, body, statusLine string, statusCode int, headers map[string][]string) error {
+	return o.each(func(out Output) error {
+		return out.HandleResponse(transactionIdentifier, body, statusLine, statusCode, headers)
+	})
+}
+
+func (o *outputs) HandleSeed(url, source, origin string) error {
+	return o.each(func(out Output) error { return out.HandleSeed(url, source, origin) })
+}
+
+func (o *outputs) HandleEndpoint(source, kind, method, value string, offset int) error {
+	return o.each(func(out Output) error { return out.HandleEndpoint(source, kind, method, value, offset) })
+}
+
+func (o *outputs) HandleSourceMap(script, url, content string) error {
+	return o.each(func(out Output) error { return out.HandleSourceMap(script, url, content) })
+}
+
+func (o *outputs) HandleRoute(target, url, kind string) error {
+	return o.each(func(out Output) error { return out.HandleRoute(target, url, kind) })
+}
+
+func (o *outputs) HandleWebSocket(requestIdentifier, url, origin, event, direction string, opcode int, payload string, headers map[string][]string,
+	timestamp time.Time) error {
+	return o.each(func(out Output) error {
+		return out.HandleWebSocket(requestIdentifier, url, origin, event, direction, opcode, payload, headers, timestamp)
+	})
+}
+
+func (o *outputs) HandleEventSourceMessage(requestIdentifier, url, origin, event, eventIdentifier, data string, timestamp time.Time) error {
+	return o.each(func(out Output) error {
+		return out.HandleEventSourceMessage(requestIdentifier, url, origin, event, eventIdentifier, data, timestamp)
+	})
+}
+
+func (o *outputs) HandlePostMessage(origin, frame, kind, messageOrigin, targetOrigin, shape, data, listener, stack string) error {
+	return o.each(func(out Output) error {
+		return out.HandlePostMessage(origin, frame, kind, messageOrigin, targetOrigin, shape, data, listener, stack)
+	})
+}
+
+func (o *outputs) HandleFinding(findingType, origin, title, detail string) error {
+	o.emit(Event{Kind: EventFinding, Finding: &Finding{Type: findingType, Origin: origin, Title: title, Detail: detail}})
+	return o.each(func(out Output) error { return out.HandleFinding(findingType, origin, title, detail) })
+}
+
+func (o *outputs) HandleReflection(origin, url, method, param, canary, context, location string) error {
+	return o.each(func(out Output) error {
+		return out.HandleReflection(origin, url, method, param, canary, context, location)
+	})
+}
+
+func (o *outputs) HandleParameter(p Parameter) error {
+	return o.each(func(out Output) error { return out.HandleParameter(p) })
+}
+
+func (o *outputs) HandleResult(r Result) error {
+	return o.each(func(out Output) error { return out.HandleResult(r) })
+}
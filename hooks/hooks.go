@@ -0,0 +1,42 @@
+// Package hooks lets programs embedding the crawler add their own checks around the crawl lifecycle
+package hooks
+
+import (
+	"github.com/go-rod/rod"
+)
+
+// Hooks are called around the crawl lifecycle so checks can be added without changing the crawl. Embed NoopHooks to
+// only implement the hooks that are needed. The request and response hooks are called from the hijack go routines,
+// the others from the crawling go routine of the job.
+type Hooks interface {
+	//Called once for every browser the crawler creates, before it is used by any job
+	OnBrowserCreated(browser *rod.Browser)
+	//Called before the page is navigated to the target
+	BeforeNavigate(page *rod.Page, target string)
+	//Called when a page state is stable, before its elements are clicked. Called again for the same state after every click.
+	OnPageState(page *rod.Page, state string)
+	//Called before an element is clicked, the element is skipped if false is returned
+	BeforeClick(page *rod.Page, element *rod.Element, xpath string) bool
+	//Called after an element was clicked
+	AfterClick(page *rod.Page, element *rod.Element, xpath string)
+	//Called for every request before it is sent, origin is the page state that made it
+	OnRequest(ctx *rod.Hijack, origin string)
+	//Called for every response before the browser gets it, which is only done when responses are saved. Streamed responses,
+	//e.g. server-sent events or a chunked long poll, are passed through to the browser without it.
+	OnResponse(ctx *rod.Hijack, origin string)
+	//Called once when the crawl of a target is done, after its page is closed. A target that is crawled again as its browser
+	//was lost is done after the last attempt.
+	OnJobDone(target string)
+}
+
+// NoopHooks does nothing and clicks every element
+type NoopHooks struct{}
+
+func (NoopHooks) OnBrowserCreated(browser *rod.Browser)                               {}
+func (NoopHooks) BeforeNavigate(page *rod.Page, target string)                        {}
+func (NoopHooks) OnPageState(page *rod.Page, state string)                            {}
+func (NoopHooks) BeforeClick(page *rod.Page, element *rod.Element, xpath string) bool { return true }
+func (NoopHooks) AfterClick(page *rod.Page, element *rod.Element, xpath string)       {}
+func (NoopHooks) OnRequest(ctx *rod.Hijack, origin string)                            {}
+func (NoopHooks) OnResponse(ctx *rod.Hijack, origin string)                           {}
+func (NoopHooks) OnJobDone(target string)                                             {}
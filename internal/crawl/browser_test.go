@@ -0,0 +1,69 @@
+package crawl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AlfredBerg/rod-crawler/internal/metrics"
+	"github.com/AlfredBerg/rod-crawler/internal/params"
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/launcher"
+)
+
+// testBrowser launches a headless chromium that is closed when the test is done, the test is skipped if none is installed
+func testBrowser(t *testing.T) *rod.Browser {
+	t.Helper()
+
+	bin, found := launcher.LookPath()
+	if !found {
+		t.Skip("no chromium installed")
+	}
+
+	l := launcher.New().Bin(bin).Headless(true)
+	u, err := l.Launch()
+	if err != nil {
+		t.Fatalf("failed launching chromium: %s", err)
+	}
+	browser := rod.New().ControlURL(u)
+	err = browser.Connect()
+	if err != nil {
+		t.Fatalf("failed connecting to chromium: %s", err)
+	}
+	browser.MustIgnoreCertErrors(true)
+
+	t.Cleanup(func() {
+		browser.Close()
+		l.Cleanup()
+	})
+	return browser
+}
+
+// discardOutput throws everything away
+type discardOutput struct{}
+
+func (discardOutput) HandleRequest(transactionIdentifier, origin, method, body, url, path, raw, host string, headers map[string][]string) error {
+	return nil
+}
+func (discardOutput) HandleResponse(transactionIdentifier, body, statusLine string, statusCode int, headers map[string][]string) error {
+	return nil
+}
+func (discardOutput) HandleSeed(url, source, origin string) error                         { return nil }
+func (discardOutput) HandleEndpoint(source, kind, method, value string, offset int) error { return nil }
+func (discardOutput) HandleSourceMap(script, url, content string) error                   { return nil }
+func (discardOutput) HandleRoute(target, url, kind string) error                          { return nil }
+func (discardOutput) HandleWebSocket(requestIdentifier, url, origin, event, direction string, opcode int, payload string, headers map[string][]string,
+	timestamp time.Time) error {
+	return nil
+}
+func (discardOutput) HandleEventSourceMessage(requestIdentifier, url, origin, event, eventIdentifier, data string, timestamp time.Time) error {
+	return nil
+}
+func (discardOutput) HandlePostMessage(origin, frame, kind, messageOrigin, targetOrigin, shape, data, listener, stack string) error {
+	return nil
+}
+func (discardOutput) HandleFinding(findingType, origin, title, detail string) error { return nil }
+func (discardOutput) HandleReflection(origin, url, method, param, canary, context, location string) error {
+	return nil
+}
+func (discardOutput) HandleParameter(p params.Parameter) error { return nil }
+func (discardOutput) HandleResult(r metrics.Result) error      { return nil }
@@ -0,0 +1,62 @@
+package crawl
+
+import "time"
+
+// Budget limits the time and the actions spent on one target, zero values are replaced by the defaults
+type Budget struct {
+	//How long the initial navigation may take
+	NavigationTimeout time.Duration
+	//How many times a failed initial navigation is tried again, a negative value means never
+	NavigationRetries int
+	//How long to wait before the first retry of the navigation, it is doubled for every retry
+	NavigationBackoff time.Duration
+	//How long to wait for a page state to become stable before looking for elements to click
+	StabilityWait time.Duration
+	//How long scrolling to and clicking an element may take
+	ClickTimeout time.Duration
+	//How many times elements are looked for and one of them is clicked
+	MaxActions int
+	//How many distinct page states are crawled, 0 means no limit
+	MaxPageStates int
+	//How many elements are tried on a page state before looking for elements again
+	MaxAttempts int
+}
+
+// DefaultBudget is used for the zero values of a Budget
+var DefaultBudget = Budget{
+	NavigationTimeout: time.Second * 5,
+	NavigationRetries: 2,
+	NavigationBackoff: time.Second * 1,
+	StabilityWait:     time.Second * 5,
+	ClickTimeout:      time.Second * 1,
+	MaxActions:        400,
+	MaxPageStates:     0,
+	MaxAttempts:       100,
+}
+
+func (b Budget) withDefaults() Budget {
+	if b.NavigationTimeout <= 0 {
+		b.NavigationTimeout = DefaultBudget.NavigationTimeout
+	}
+	if b.NavigationRetries == 0 {
+		b.NavigationRetries = DefaultBudget.NavigationRetries
+	} else if b.NavigationRetries < 0 {
+		b.NavigationRetries = 0
+	}
+	if b.NavigationBackoff <= 0 {
+		b.NavigationBackoff = DefaultBudget.NavigationBackoff
+	}
+	if b.StabilityWait <= 0 {
+		b.StabilityWait = DefaultBudget.StabilityWait
+	}
+	if b.ClickTimeout <= 0 {
+		b.ClickTimeout = DefaultBudget.ClickTimeout
+	}
+	if b.MaxActions <= 0 {
+		b.MaxActions = DefaultBudget.MaxActions
+	}
+	if b.MaxAttempts <= 0 {
+		b.MaxAttempts = DefaultBudget.MaxAttempts
+	}
+	return b
+}
@@ -0,0 +1,51 @@
+package crawl
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+	"go.uber.org/zap"
+)
+
+var (
+	errTabCrashed       = errors.New("the tab crashed")
+	errBrowserConnClose = errors.New("the connection to the browser was closed")
+)
+
+// watchCrash cancels the crawl with cancel when the tab crashes or the connection to the browser is lost, stop must be
+// called when the crawl is done
+func (j *Job) watchCrash(page *rod.Page, cancel context.CancelFunc) (stop func()) {
+	ctx, stopWatching := context.WithCancel(page.GetContext())
+	wait := page.Context(ctx).EachEvent(func(e *proto.InspectorTargetCrashed) bool {
+		j.crash(errTabCrashed, cancel)
+		return true
+	})
+	j.goRunning(func() {
+		wait()
+		//The events only stop before the crawl is done if the websocket to the browser was closed
+		if ctx.Err() == nil {
+			j.crash(errBrowserConnClose, cancel)
+		}
+	})
+	return stopWatching
+}
+
+func (j *Job) crash(err error, cancel context.CancelFunc) {
+	j.crashLock.Lock()
+	if j.crashErr == nil {
+		j.crashErr = err
+	}
+	j.crashLock.Unlock()
+
+	j.log().Error("browser lost, stopping crawl", zap.Error(err), zap.String("target", j.Target))
+	cancel()
+}
+
+// crashed returns why the browser was lost, nil if it was not
+func (j *Job) crashed() error {
+	j.crashLock.Lock()
+	defer j.crashLock.Unlock()
+	return j.crashErr
+}
@@ -1,229 +1,633 @@
 package crawl
 
 import (
+	"context"
 	"crypto/tls"
+	"encoding/json"
 	"math/rand"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/AlfredBerg/rod-crawler/internal/endpoints"
+	"github.com/AlfredBerg/rod-crawler/internal/frontier"
 	"github.com/AlfredBerg/rod-crawler/internal/js"
+	"github.com/AlfredBerg/rod-crawler/internal/metrics"
+	"github.com/AlfredBerg/rod-crawler/internal/scope"
+	"github.com/AlfredBerg/rod-crawler/internal/sourcemap"
 	"github.com/go-rod/rod"
 	"github.com/go-rod/rod/lib/proto"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
-func (j *Job) Crawl(saveResponses bool) {
+// Crawl clicks around on the target until the budget is spent, there is nothing left to click, the crawl timeout is
+// reached or ctx is canceled. Saving the result and calling the OnJobDone hook is up to the caller, as the target may be crawled again.
+func (j *Job) Crawl(ctx context.Context, saveResponses bool) (res metrics.Result) {
+	budget := j.Budget.withDefaults()
 	j.clickedElements = make(map[string]int)
+	j.probed = make(map[string]bool)
+	j.snippetStates = make(map[string]bool)
+
+	j.metrics = metrics.NewCollector()
+	res = metrics.Result{Target: j.Target, Depth: j.Depth, Attempt: max(j.Attempt, 1), Started: time.Now()}
+	//Done last so the teardown is included
+	defer func() {
+		res.Metrics = j.metrics.Metrics()
+		res.StopReason = j.metrics.StopReason()
+		res.Status = metrics.Status(res.StopReason)
+		if j.err != nil {
+			res.Error = j.err.Error()
+		}
+		j.routeLock.Lock()
+		res.FinalUrl = j.route
+		j.routeLock.Unlock()
+		res.Duration = time.Since(res.Started)
+	}()
+
+	//Everything done in the browser for the job stops when ctx is canceled, or when the job is done
+	ctx, cancel := context.WithCancel(ctx)
+	j.Browser = j.Browser.Context(ctx)
+	j.ctx = ctx
 
 	// Create a new empty page so we can setup request hijacks
-	page := j.Browser.Timeout(j.CrawlTimeout).MustPage()
-	defer page.Close()
+	page, err := j.Browser.Timeout(j.CrawlTimeout).Page(proto.TargetCreateTarget{})
+	if err != nil {
+		cancel()
+		j.metrics.Stop(metrics.StopBrowserFailed)
+		j.err = err
+		j.log().Error("failed creating page, crawling ended early", zap.Error(err), zap.String("target", j.Target))
+		return res
+	}
+	j.pageCtx = page.GetContext()
 
 	//Set InsecureSkipVerify as we want to be able to crawl pages with bad certificates
 	tr := &http.Transport{
 		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 	}
-	client := &http.Client{Transport: tr}
+	j.client = &http.Client{Transport: tr}
+
+	//Teardown, in reverse order: the event listeners and the router are stopped, the started work is waited for, the go routines
+	//running until the job is done are stopped and waited for, and last the tab is closed
+	defer func() {
+		//The context may already be canceled, the tab must be closed anyway
+		j.closeOpened(page.Context(context.Background()).Timeout(time.Second * 5))
+		err := page.Context(context.Background()).Timeout(time.Second * 5).Close()
+		if err != nil {
+			j.log().Debug("failed closing tab", zap.Error(err))
+		}
+	}()
+	defer j.running.Wait()
+	defer cancel()
+	defer tr.CloseIdleConnections()
+	defer j.background.close()
+
+	j.setupPage(page)
+
+	stopCrashWatch := j.watchCrash(page, cancel)
+	defer stopCrashWatch()
+
 	router := page.HijackRequests()
 	router.MustAdd("*", func(ctx *rod.Hijack) {
-		req, err := httputil.DumpRequest(ctx.Request.Req(), true)
-		if err != nil {
-			zap.L().Error("failed capturing request with error", zap.Error(err))
+		//The job is being torn down, let the request through untouched
+		if !j.background.start() {
 			ctx.ContinueRequest(&proto.FetchContinueRequest{})
 			return
 		}
-		info, err := page.Info()
+		defer j.background.done()
+
+		//When responses are saved requests are paused twice, before they are sent and when their response is received
+		var paused *proto.FetchRequestPaused
+		if saveResponses {
+			paused = j.responses.takePaused(ctx.Response.Payload().RequestID)
+			if paused == nil {
+				ctx.ContinueRequest(&proto.FetchContinueRequest{})
+				return
+			}
+			if atResponseStage(paused) {
+				j.onResponse(page, ctx, paused)
+				return
+			}
+		}
+
+		req, err := httputil.DumpRequest(ctx.Request.Req(), true)
 		if err != nil {
-			zap.L().Error("failed getting page info with error", zap.Error(err))
+			j.log().Error("failed capturing request with error", zap.Error(err))
 			ctx.ContinueRequest(&proto.FetchContinueRequest{})
 			return
 		}
+		origin := j.currentRoute(page)
 
 		transactionUuid := uuid.New().String()
+		j.metrics.Request(ctx.Request.Method(), ctx.Request.URL())
 
-		j.OutputHandler.HandleRequest(transactionUuid, info.URL, ctx.Request.Req().Method, ctx.Request.Body(), ctx.Request.URL().String(),
+		if ctx.Request.Type() == proto.NetworkResourceTypeDocument && ctx.Request.Method() == http.MethodGet {
+			j.harvest(ctx.Request.URL().String(), "request")
+		}
+
+		j.OutputHandler.HandleRequest(transactionUuid, origin, ctx.Request.Req().Method, ctx.Request.Body(), ctx.Request.URL().String(),
 			ctx.Request.URL().Path, string(req), ctx.Request.URL().Hostname(), ctx.Request.Req().Header)
+		j.requestParams(ctx.Request.Req(), ctx.Request.Body(), origin)
+		j.hooks().OnRequest(ctx, origin)
+
+		//Only look for the source map of in scope scripts, and only once per script
+		findSourceMap := j.SourceMaps != nil && ctx.Request.Type() == proto.NetworkResourceTypeScript &&
+			scope.InScope(ctx.Request.URL().Hostname(), j.Scope) && j.SourceMaps.First(ctx.Request.URL().String())
 
 		if !saveResponses {
 			ctx.ContinueRequest(&proto.FetchContinueRequest{})
+			if findSourceMap {
+				j.background.Go(func() {
+					j.sourceMap(ctx.Request.URL().String(), nil, "", false)
+				})
+			}
 			return
 		}
 
-		err = ctx.LoadResponse(client, true)
+		//The response is saved by onResponse when the request is paused again
+		j.responses.addRequest(paused, capturedRequest{transaction: transactionUuid, origin: origin, url: ctx.Request.URL().String(),
+			script: ctx.Request.Type() == proto.NetworkResourceTypeScript, sourceMap: findSourceMap})
+		ctx.ContinueRequest(&proto.FetchContinueRequest{})
+	})
+	if saveResponses {
+		stopCapture, err := j.captureResponses(page)
 		if err != nil {
-			zap.L().Error("failed loading responses with error", zap.Error(err))
-			ctx.ContinueRequest(&proto.FetchContinueRequest{})
-			return
+			j.metrics.Stop(metrics.StopBrowserFailed)
+			j.err = err
+			j.log().Error("failed intercepting responses, crawling ended early", zap.Error(err), zap.String("target", j.Target))
+			return res
+		}
+		defer stopCapture()
+	}
+	j.goRunning(router.Run)
+	defer func() {
+		err := router.Stop()
+		if err != nil {
+			j.log().Debug("failed stopping request hijacking", zap.Error(err))
 		}
+	}()
 
-		j.OutputHandler.HandleResponse(transactionUuid, ctx.Response.Body(), ctx.Response.Payload().ResponsePhrase, ctx.Response.Payload().ResponseCode, ctx.Response.Headers())
+	instrumentations := []instrumentation{
+		{script: js.ROUTE_HOOK, binding: js.ROUTE_BINDING, handler: j.onRoute},
+		{script: js.POSTMESSAGE_HOOK, binding: js.POSTMESSAGE_BINDING, handler: func(payload string) { j.onPostMessage(page, payload) }},
+	}
+	if j.DomXss {
+		//A canary per job makes it possible to tell which crawl a sink hit came from
+		canary := "rcx" + strings.ReplaceAll(uuid.New().String(), "-", "")[:10]
+		instrumentations = append(instrumentations, instrumentation{
+			script:  "(" + js.DOM_XSS_HOOK + ")(" + strconv.Quote(canary) + ");",
+			binding: js.DOM_XSS_BINDING,
+			handler: func(payload string) { j.onDomXss(page, payload) },
+		})
+	}
+	stopInstrumentation := j.instrument(page, instrumentations)
+	defer stopInstrumentation()
 
-	})
-	go router.Run()
+	stopNetwork := j.watchNetwork(page)
+	defer stopNetwork()
 
 	//Keep focus on tab
-	go func() {
+	j.goRunning(func() {
 		t := time.NewTicker(time.Second * 2)
+		defer t.Stop()
 
-		for range t.C {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
 			_, err := page.Activate()
 			if err != nil {
-				zap.L().Error("failed focusing tab,", zap.Error(err))
+				j.log().Error("failed focusing tab,", zap.Error(err))
 				return
 			}
 		}
-	}()
+	})
 
-	err := page.Timeout(time.Second * 5).Navigate(j.Target)
+	j.hooks().BeforeNavigate(page, j.Target)
+	navigationStart := time.Now()
+	res.NavigationAttempts, err = j.navigate(page, budget)
+	res.NavigationDuration = time.Since(navigationStart)
 	if err != nil {
-		zap.L().Error("could not navigate to the initial page, crawling ended early", zap.String("target", j.Target))
-		return
+		if crashErr := j.crashed(); crashErr != nil {
+			j.metrics.Stop(metrics.StopBrowserCrashed)
+			err = crashErr
+		} else if j.ctx.Err() != nil {
+			j.metrics.Stop(metrics.StopCanceled)
+		} else {
+			j.metrics.Stop(metrics.StopNavigationFailed)
+		}
+		j.err = err
+		j.log().Error("could not navigate to the initial page, crawling ended early", zap.Error(err), zap.String("target", j.Target))
+		return res
 	}
 
-	for i := 0; i < 400; i++ {
+	states := map[string]bool{}
+	for i := 0; i < budget.MaxActions; i++ {
 		//Is the context canceled?
 		if page.GetContext().Err() != nil {
+			j.stopCanceled(page.GetContext().Err())
 			break
 		}
 
-		info, err := page.Info()
+		//Every client side route is its own page state, elements are clicked once per state
+		state := j.currentRoute(page)
+		currentUrl, err := url.Parse(state)
 		if err != nil {
-			zap.L().Error("page info errored out due to", zap.Error(err))
+			j.log().Error("could not parse url", zap.Error(err), zap.String("url", state))
+			j.metrics.Stop(metrics.StopInvalidUrl)
+			j.err = err
+			break
 		}
 
-		currentUrl, err := url.Parse(info.URL)
-		if err != nil {
-			zap.L().Error("could not parse url", zap.Error(err), zap.String("url", info.URL))
+		//Are we in scope?
+		if !scope.InScope(currentUrl.Hostname(), j.Scope) {
+			j.log().Info("crawler went out of scope, stopping crawl", zap.String("url", currentUrl.String()))
+			j.metrics.Stop(metrics.StopOutOfScope)
+			break
 		}
 
-		//Are we in scope?
-		if len(j.Scope) != 0 {
-			inScope := false
-			for _, s := range j.Scope {
-				cHost := currentUrl.Hostname()
-				if cHost == s {
-					inScope = true
-					break
-				}
-				if strings.HasSuffix(cHost, "."+s) {
-					inScope = true
-					break
-				}
-			}
-			if !inScope {
-				zap.L().Info("crawler went out of scope, stopping crawl", zap.String("url", currentUrl.String()))
+		if !states[state] {
+			if budget.MaxPageStates != 0 && len(states) >= budget.MaxPageStates {
+				j.log().Info("max page states reached, stopping crawl", zap.String("target", j.Target))
+				j.metrics.Stop(metrics.StopMaxPageStates)
 				break
 			}
+			states[state] = true
+			j.metrics.PageState(state)
 		}
 
-		err = page.Timeout(time.Second * 5).WaitStable(time.Second)
+		err = page.Timeout(budget.StabilityWait).WaitStable(time.Second)
 		if err != nil {
-			zap.L().Error("wait stable errored out due to", zap.Error(err))
+			j.log().Error("wait stable errored out due to", zap.Error(err))
 		}
 
-		//TOOD: This should be some seperate table in the db, not shoehorned into the request table
-		paramUrlRes, err := page.Eval(js.GET_POTENTIAL_PARAMS)
-		if err != nil {
-			zap.L().Error("error getting parameters", zap.Error(err))
-		} else {
-			paramUrl := paramUrlRes.Value.Str()
-			if paramUrl != "" {
-				url, err := url.Parse(paramUrl)
-				if err != nil {
-					zap.L().Error("failed parsing parameter extraction url", zap.Error(err), zap.String("url", paramUrl))
-				} else {
-					j.OutputHandler.HandleRequest("", info.URL, "GET", "", paramUrl, url.Path, "", url.Hostname(), nil)
+		if j.Frontier != nil {
+			linksRes, err := page.Eval(js.GET_LINKS)
+			if err != nil {
+				j.log().Error("error getting links", zap.Error(err))
+			} else {
+				for _, l := range linksRes.Value.Arr() {
+					j.harvest(l.Str(), "dom")
 				}
 			}
 		}
 
+		if j.Reflection {
+			j.findReflections(page, state)
+		}
+
+		j.pageParams(page, state)
+		j.runSnippets(page, state)
+		j.hooks().OnPageState(page, state)
+
 		elements, err := page.ElementsByJS(rod.Eval(js.GET_ELEMENTS))
 		if err != nil {
-			zap.L().Error("get elements errored out due to", zap.Error(err))
+			j.log().Error("get elements errored out due to", zap.Error(err))
 			continue
 		}
-		elements = filterNonClickedElements(elements, j.clickedElements)
+		elements = j.filterNonClickedElements(elements, state)
 		if len(elements) == 0 {
+			j.metrics.Stop(metrics.StopNoElements)
 			break
 		}
 
-		for i := 0; i < 100; i++ {
+		for i := 0; i < budget.MaxAttempts; i++ {
 			//Is the context canceled?
 			if page.GetContext().Err() != nil {
+				j.stopCanceled(page.GetContext().Err())
 				break
 			}
 
-			interactUrl, err := url.Parse(info.URL)
-			if err != nil {
-				zap.L().Error("could not parse interact url", zap.Error(err), zap.String("url", info.URL))
-			}
-			// The url has changed, we should run the js to get new clickable elements again and check that we are still in scope
-			if currentUrl.String() != interactUrl.String() {
+			// The route has changed, we should run the js to get new clickable elements again and check that we are still in scope
+			if j.currentRoute(page) != state {
 				break
 			}
 
 			sRect := rand.Intn(len(elements))
-			e := elements[sRect].Timeout(time.Second * 1)
+			e := elements[sRect].Timeout(budget.ClickTimeout)
 			err = e.ScrollIntoView()
 			if err != nil {
-				zap.L().Error("scroll error", zap.Error(err))
+				j.log().Error("scroll error", zap.Error(err))
 				continue
 			}
 
 			xp, err := e.GetXPath(false)
 			if err != nil {
-				zap.L().Error("xapth error", zap.Error(err))
+				j.log().Error("xapth error", zap.Error(err))
 				continue
 			}
 
-			if j.clickedElements[xp] != 0 {
-				zap.L().Debug("xpath element has already been clicked", zap.String("xpath", xp))
+			if j.clickedElements[state+" "+xp] != 0 {
+				j.log().Debug("xpath element has already been clicked", zap.String("xpath", xp))
 				continue
 			}
 
 			//Is the element actually on top and can be clicked?
 			jsEvalRes, err := page.Eval(js.IS_TOP_VISIBLE, xp)
 			if err != nil {
-				zap.L().Error("visible js error", zap.Error(err))
+				j.log().Error("visible js error", zap.Error(err))
 				continue
 			}
 			isVisible := jsEvalRes.Value
 
-			zap.L().Debug("visibility of xpath", zap.Bool("isVisible", isVisible.Bool()), zap.String("xpath", xp))
+			j.log().Debug("visibility of xpath", zap.Bool("isVisible", isVisible.Bool()), zap.String("xpath", xp))
 			if !isVisible.Bool() {
+				j.metrics.Invisible(state + " " + xp)
+				continue
+			}
+
+			if !j.hooks().BeforeClick(page, e, xp) {
+				//Never try it again
+				j.clickedElements[state+" "+xp] += 1
 				continue
 			}
 
 			err = e.Click(proto.InputMouseButtonLeft, 1)
 			if err != nil {
-				zap.L().Error("cick failed", zap.Error(err))
+				j.log().Error("cick failed", zap.Error(err))
 				continue
 			}
-			zap.L().Info("clicked", zap.String("xpath", xp))
-			j.clickedElements[xp] += 1
+			j.log().Info("clicked", zap.String("xpath", xp))
+			j.clickedElements[state+" "+xp] += 1
+			j.metrics.Clicked(state + " " + xp)
+			j.hooks().AfterClick(page, e, xp)
 			break
 		}
 	}
-	zap.L().Info("crawling done for", zap.String("target", j.Target))
+	//Only the first reason is kept, this is the reason if the loop ran out
+	j.metrics.Stop(metrics.StopMaxActions)
+	j.log().Info("crawling done for", zap.String("target", j.Target))
+	return res
+}
+
+// stopCanceled records why the page's context was canceled with err, the crawl timeout or ctx given to Crawl
+func (j *Job) stopCanceled(err error) {
+	j.err = err
+	if crashErr := j.crashed(); crashErr != nil {
+		j.err = crashErr
+		j.metrics.Stop(metrics.StopBrowserCrashed)
+	} else if j.ctx.Err() != nil {
+		j.metrics.Stop(metrics.StopCanceled)
+	} else {
+		j.metrics.Stop(metrics.StopTimeout)
+	}
+}
+
+// navigate navigates to the target, a failed navigation is retried with an exponential backoff
+func (j *Job) navigate(page *rod.Page, budget Budget) (attempts int, err error) {
+	backoff := budget.NavigationBackoff
+	for {
+		attempts++
+		err = page.Timeout(budget.NavigationTimeout).Navigate(j.Target)
+		if err == nil || attempts > budget.NavigationRetries || page.GetContext().Err() != nil {
+			return attempts, err
+		}
+
+		j.log().Warn("navigation failed, retrying", zap.Error(err), zap.String("target", j.Target), zap.Duration("backoff", backoff))
+		t := time.NewTimer(backoff)
+		select {
+		case <-page.GetContext().Done():
+			t.Stop()
+			return attempts, err
+		case <-t.C:
+		}
+		backoff *= 2
+	}
+}
+
+// onRoute is called by ROUTE_HOOK when a document is loaded or the client side route changes
+func (j *Job) onRoute(payload string) {
+	var r struct {
+		Kind string `json:"kind"`
+		Url  string `json:"url"`
+	}
+	err := json.Unmarshal([]byte(payload), &r)
+	if err != nil {
+		j.log().Error("failed parsing route change", zap.Error(err), zap.String("payload", payload))
+		return
+	}
+
+	j.routeLock.Lock()
+	changed := j.route != r.Url
+	j.route = r.Url
+	j.routeLock.Unlock()
+
+	if changed {
+		j.log().Debug("route changed", zap.String("kind", r.Kind), zap.String("url", r.Url))
+		j.OutputHandler.HandleRoute(j.Target, r.Url, r.Kind)
+	}
+}
+
+// onPostMessage is called by POSTMESSAGE_HOOK when a message is sent or received or a message listener is registered
+func (j *Job) onPostMessage(page *rod.Page, payload string) {
+	var m struct {
+		Kind         string          `json:"kind"`
+		Frame        string          `json:"frame"`
+		Origin       string          `json:"origin"`
+		TargetOrigin string          `json:"targetOrigin"`
+		Shape        json.RawMessage `json:"shape"`
+		Data         string          `json:"data"`
+		Listener     string          `json:"listener"`
+		Stack        string          `json:"stack"`
+	}
+	err := json.Unmarshal([]byte(payload), &m)
+	if err != nil {
+		j.log().Error("failed parsing post message", zap.Error(err), zap.String("payload", payload))
+		return
+	}
+
+	j.log().Debug("post message", zap.String("kind", m.Kind), zap.String("frame", m.Frame))
+	j.OutputHandler.HandlePostMessage(j.currentRoute(page), m.Frame, m.Kind, m.Origin, m.TargetOrigin, string(m.Shape), m.Data, m.Listener, m.Stack)
+}
+
+// onDomXss is called by DOM_XSS_HOOK when a value from a source reaches a sink
+func (j *Job) onDomXss(page *rod.Page, payload string) {
+	var hit struct {
+		Sink   string `json:"sink"`
+		Source string `json:"source"`
+	}
+	err := json.Unmarshal([]byte(payload), &hit)
+	if err != nil {
+		j.log().Error("failed parsing dom xss sink hit", zap.Error(err), zap.String("payload", payload))
+		return
+	}
+
+	j.log().Info("dom xss source reached sink", zap.String("sink", hit.Sink), zap.String("source", hit.Source))
+	j.OutputHandler.HandleFinding("dom-xss", j.currentRoute(page), hit.Sink+" <- "+hit.Source, payload)
+}
+
+// currentRoute is the url of the current page state, including client side routing
+func (j *Job) currentRoute(page *rod.Page) string {
+	j.routeLock.Lock()
+	route := j.route
+	j.routeLock.Unlock()
+	if route != "" {
+		return route
+	}
+
+	//The route hook has not reported anything yet, e.g. for the very first request
+	info, err := page.Info()
+	if err != nil {
+		j.log().Error("page info errored out due to", zap.Error(err))
+		return ""
+	}
+	return info.URL
+}
+
+// closeOpened closes the tabs opened by the tab of the job, e.g. popups, and the tabs they opened in turn. Other tabs of the
+// browser are left alone, they may belong to other jobs or to the user.
+func (j *Job) closeOpened(page *rod.Page) {
+	browser := page.Browser().Context(page.GetContext())
+	targets, err := proto.TargetGetTargets{}.Call(browser)
+	if err != nil {
+		j.log().Debug("failed getting the tabs opened by the job", zap.Error(err))
+		return
+	}
+
+	opened := map[proto.TargetTargetID]bool{page.TargetID: true}
+	for found := true; found; {
+		found = false
+		for _, t := range targets.TargetInfos {
+			if t.OpenerID != "" && opened[t.OpenerID] && !opened[t.TargetID] {
+				opened[t.TargetID] = true
+				found = true
+			}
+		}
+	}
+	delete(opened, page.TargetID)
+
+	for id := range opened {
+		_, err := proto.TargetCloseTarget{TargetID: id}.Call(browser)
+		if err != nil {
+			j.log().Debug("failed closing tab opened by the job", zap.Error(err))
+		}
+	}
+}
+
+// extractEndpoints saves the urls, paths and api calls found in a javascript file
+func (j *Job) extractEndpoints(source, body string) {
+	found := endpoints.Extract(body)
+	for _, e := range found {
+		j.OutputHandler.HandleEndpoint(source, e.Kind, e.Method, e.Value, e.Offset)
+	}
+	j.log().Debug("extracted endpoints from javascript", zap.String("source", source), zap.Int("endpoints", len(found)))
+}
+
+// sourceMap saves the source map of a script if it is in scope. The script is downloaded again if its response was not captured.
+// The downloads stop when the crawl is canceled or times out, so they don't hold up the teardown.
+func (j *Job) sourceMap(scriptURL string, headers http.Header, body string, captured bool) {
+	if !captured {
+		var err error
+		headers, body, err = j.SourceMaps.Script(j.pageCtx, scriptURL)
+		if err != nil {
+			j.log().Debug("failed downloading script to find its source map", zap.Error(err), zap.String("url", scriptURL))
+			return
+		}
+	}
+
+	mapURL := sourcemap.MapURL(scriptURL, headers, body)
+	if mapURL == "" {
+		return
+	}
+	//The source map can be anywhere, data urls are decoded without a request
+	if !strings.HasPrefix(mapURL, "data:") {
+		u, err := url.Parse(mapURL)
+		if err != nil || !scope.InScope(u.Hostname(), j.Scope) {
+			j.log().Debug("skipping out of scope source map", zap.String("url", mapURL), zap.String("script", scriptURL))
+			return
+		}
+	}
+
+	content, err := j.SourceMaps.Fetch(j.pageCtx, mapURL)
+	if err != nil {
+		j.log().Debug("failed downloading source map", zap.Error(err), zap.String("url", mapURL))
+		return
+	}
+	if _, err := sourcemap.Parse(content); err != nil {
+		j.log().Debug("not a valid source map", zap.Error(err), zap.String("url", mapURL))
+		return
+	}
+
+	j.log().Info("found source map", zap.String("script", scriptURL))
+	j.OutputHandler.HandleSourceMap(scriptURL, mapURL, content)
+}
+
+// harvest queues an url found while crawling as a new target one level deeper than the current one
+func (j *Job) harvest(u, source string) {
+	if j.Frontier == nil {
+		return
+	}
+	if j.Frontier.Add(frontier.Target{Url: u, Depth: j.Depth + 1, Source: source}) {
+		j.log().Debug("queued new target", zap.String("url", u), zap.String("source", source))
+	}
 }
 
-func filterNonClickedElements(elements rod.Elements, clickedElements map[string]int) rod.Elements {
+func (j *Job) filterNonClickedElements(elements rod.Elements, state string) rod.Elements {
 	notClickedElements := rod.Elements{}
 
 	for _, e := range elements {
 		xp, err := e.GetXPath(false)
 		if err != nil {
-			zap.L().Error("failed getting xpath", zap.Error(err))
+			j.log().Error("failed getting xpath", zap.Error(err))
 			continue
 		}
-		if clickedElements[xp] == 0 {
+		j.metrics.Discovered(state + " " + xp)
+		if j.clickedElements[state+" "+xp] == 0 {
 			notClickedElements = append(notClickedElements, e)
 		}
 	}
 
 	return notClickedElements
 }
+
+// setupPage applies the emulation and extra headers to a tab
+func (j *Job) setupPage(page *rod.Page) {
+	j.emulate(page)
+
+	if len(j.Headers) != 0 {
+		dict := []string{}
+		for name, value := range j.Headers {
+			dict = append(dict, name, value)
+		}
+		_, err := page.SetExtraHeaders(dict)
+		if err != nil {
+			j.log().Error("failed setting extra headers", zap.Error(err))
+		}
+	}
+}
+
+func (j *Job) emulate(page *rod.Page) {
+	if j.Emulation.Timezone != "" {
+		err := proto.EmulationSetTimezoneOverride{TimezoneID: j.Emulation.Timezone}.Call(page)
+		if err != nil {
+			j.log().Error("failed setting timezone", zap.Error(err), zap.String("timezone", j.Emulation.Timezone))
+		}
+	}
+
+	if j.Emulation.Locale != "" {
+		err := proto.EmulationSetLocaleOverride{Locale: j.Emulation.Locale}.Call(page)
+		if err != nil {
+			j.log().Error("failed setting locale", zap.Error(err), zap.String("locale", j.Emulation.Locale))
+		}
+	}
+
+	if j.Emulation.Geolocation != nil {
+		//Without the permission the page is never given the position
+		err := proto.BrowserGrantPermissions{
+			Permissions:      []proto.BrowserPermissionType{proto.BrowserPermissionTypeGeolocation},
+			BrowserContextID: j.Browser.BrowserContextID,
+		}.Call(j.Browser)
+		if err != nil {
+			j.log().Error("failed granting geolocation permission", zap.Error(err))
+		}
+		err = j.Emulation.Geolocation.Call(page)
+		if err != nil {
+			j.log().Error("failed setting geolocation", zap.Error(err))
+		}
+	}
+}
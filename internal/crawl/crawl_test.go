@@ -0,0 +1,195 @@
+package crawl
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/AlfredBerg/rod-crawler/hooks"
+	"github.com/AlfredBerg/rod-crawler/internal/fixture"
+	"github.com/AlfredBerg/rod-crawler/internal/metrics"
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+const leakPage = `<html><body>
+<a href="/a">a</a>
+<button onclick="history.pushState({}, '', '/b')">b</button>
+<script>fetch('/api')</script>
+</body></html>`
+
+func TestCrawlStopsItsGoroutines(t *testing.T) {
+	browser := testBrowser(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, leakPage)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	crawl := func(saveResponses bool) {
+		j := Job{Browser: browser, Target: srv.URL, CrawlTimeout: time.Second * 20, OutputHandler: discardOutput{}, Scope: []string{u.Hostname()},
+			Budget: Budget{MaxActions: 5}, Reflection: true}
+		j.Crawl(context.Background(), saveResponses)
+	}
+
+	//The first crawl starts the go routines the browser connection keeps for its lifetime
+	crawl(true)
+	before := settledGoroutines(0)
+
+	for i := 0; i < 3; i++ {
+		crawl(i%2 == 0)
+	}
+
+	after := settledGoroutines(before)
+	if after > before {
+		buf := make([]byte, 1<<20)
+		t.Fatalf("goroutines leaked by the crawls: %d before, %d after\n%s", before, after, buf[:runtime.Stack(buf, true)])
+	}
+}
+
+func TestCrawlStopsWhenCanceled(t *testing.T) {
+	browser := testBrowser(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, leakPage)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	defer cancel()
+
+	start := time.Now()
+	j := Job{Browser: browser, Target: srv.URL, CrawlTimeout: time.Minute, OutputHandler: discardOutput{}, Scope: []string{u.Hostname()},
+		Budget: Budget{StabilityWait: time.Minute}}
+	res := j.Crawl(ctx, false)
+
+	if elapsed := time.Since(start); elapsed > time.Second*15 {
+		t.Fatalf("crawl took %s after its context was canceled", elapsed)
+	}
+	if res.Status != metrics.StatusCanceled {
+		t.Errorf("status is %q (%s), want %q", res.Status, res.StopReason, metrics.StatusCanceled)
+	}
+}
+
+func TestCrawlResultOfUnreachableTarget(t *testing.T) {
+	browser := testBrowser(t)
+
+	//Nothing listens on the closed server's port
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	j := Job{Browser: browser, Target: srv.URL, CrawlTimeout: time.Minute, OutputHandler: discardOutput{}, Scope: []string{"127.0.0.1"},
+		Budget: Budget{NavigationRetries: -1}}
+	res := j.Crawl(context.Background(), false)
+
+	if res.Status != metrics.StatusFailed || res.StopReason != metrics.StopNavigationFailed {
+		t.Errorf("status is %q (%s), want %q (%s)", res.Status, res.StopReason, metrics.StatusFailed, metrics.StopNavigationFailed)
+	}
+	if res.Error == "" {
+		t.Error("the navigation error is not in the result")
+	}
+}
+
+// settledGoroutines waits a while for the number of go routines to go down to target, and returns the number
+func settledGoroutines(target int) int {
+	n := runtime.NumGoroutine()
+	for i := 0; i < 50 && n > target; i++ {
+		time.Sleep(time.Millisecond * 100)
+		n = runtime.NumGoroutine()
+	}
+	return n
+}
+
+func TestCrawlRetriesNavigation(t *testing.T) {
+	browser := testBrowser(t)
+
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	j := Job{Browser: browser, Target: srv.URL, CrawlTimeout: time.Minute, OutputHandler: discardOutput{}, Scope: []string{"127.0.0.1"},
+		Budget: Budget{NavigationRetries: 2, NavigationBackoff: time.Millisecond * 10}}
+	res := j.Crawl(context.Background(), false)
+
+	if res.NavigationAttempts != 3 {
+		t.Errorf("navigated %d times, want 3", res.NavigationAttempts)
+	}
+	if res.StopReason != metrics.StopNavigationFailed {
+		t.Errorf("stop reason is %q, want %q", res.StopReason, metrics.StopNavigationFailed)
+	}
+}
+
+// crashTab crashes the tab on the first page state and waits for the crawl to notice
+type crashTab struct {
+	hooks.NoopHooks
+}
+
+func (crashTab) OnPageState(page *rod.Page, state string) {
+	_ = page.Navigate("chrome://crash")
+	select {
+	case <-page.GetContext().Done():
+	case <-time.After(time.Second * 10):
+	}
+}
+
+func TestCrawlStopsWhenTabCrashes(t *testing.T) {
+	browser := testBrowser(t)
+
+	site := fixture.New()
+	defer site.Close()
+
+	j := Job{Browser: browser, Target: site.URL("/links"), CrawlTimeout: time.Minute, OutputHandler: discardOutput{}, Scope: []string{"127.0.0.1"},
+		Hooks: crashTab{}}
+	res := j.Crawl(context.Background(), false)
+
+	if res.StopReason != metrics.StopBrowserCrashed || res.Status != metrics.StatusFailed {
+		t.Errorf("status is %q (%s), want %q (%s)", res.Status, res.StopReason, metrics.StatusFailed, metrics.StopBrowserCrashed)
+	}
+}
+
+func TestCrawlClosesOnlyItsTabs(t *testing.T) {
+	browser := testBrowser(t)
+
+	site := fixture.New()
+	defer site.Close()
+
+	//A tab of another job or of the user, it must be left open
+	other, err := browser.Page(proto.TargetCreateTarget{URL: site.URL("/links")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := tabs(t, browser)
+
+	j := Job{Browser: browser, Target: site.URL("/popup"), CrawlTimeout: time.Minute, OutputHandler: discardOutput{}, Scope: []string{"127.0.0.1"},
+		Budget: Budget{MaxActions: 5}}
+	j.Crawl(context.Background(), false)
+
+	after := tabs(t, browser)
+	if !after[other.TargetID] {
+		t.Error("a tab not opened by the job was closed")
+	}
+	for id := range after {
+		if !before[id] {
+			t.Errorf("tab %s opened by the job was not closed", id)
+		}
+	}
+}
+
+func tabs(t *testing.T, browser *rod.Browser) map[proto.TargetTargetID]bool {
+	t.Helper()
+	pages, err := browser.Pages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := map[proto.TargetTargetID]bool{}
+	for _, p := range pages {
+		ids[p.TargetID] = true
+	}
+	return ids
+}
@@ -0,0 +1,105 @@
+package crawl
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+	"go.uber.org/zap"
+)
+
+// instrumentation is a script injected into every document of the crawled tab before the page's own scripts run.
+// The script reports back to the crawler by calling window[binding](payload), which calls handler.
+type instrumentation struct {
+	script  string
+	binding string
+	handler func(payload string)
+}
+
+// Out of process iframes, i.e. cross-origin ones with site isolation, are targets of their own
+const iframeTarget = proto.TargetTargetInfoType("iframe")
+
+// instrument injects the scripts into the tab and into its cross-origin iframes, and starts handling the binding calls.
+// stop must be called when the crawl is done.
+func (j *Job) instrument(page *rod.Page, instrumentations []instrumentation) (stop func()) {
+	handlers := map[string]func(payload string){}
+	for _, i := range instrumentations {
+		handlers[i.binding] = i.handler
+	}
+
+	//The sessions of the tab and of its iframes, the events of other tabs in the browser are ignored
+	var lock sync.Mutex
+	sessions := map[proto.TargetSessionID]bool{page.SessionID: true}
+	ours := func(id proto.TargetSessionID) bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return sessions[id]
+	}
+
+	ctx, cancel := context.WithCancel(page.GetContext())
+	//Subscribed before the tab auto attaches its iframes so none of them are missed
+	wait := j.Browser.Context(ctx).EachEvent(
+		func(e *proto.TargetAttachedToTarget, sessionID proto.TargetSessionID) {
+			if !ours(sessionID) {
+				return
+			}
+			target := j.Browser.Context(ctx).PageFromSession(e.SessionID)
+			if e.TargetInfo.Type == iframeTarget {
+				lock.Lock()
+				sessions[e.SessionID] = true
+				lock.Unlock()
+				j.installInstrumentation(target, instrumentations)
+			}
+			//Attached targets, including workers, wait until they are told to run
+			err := proto.RuntimeRunIfWaitingForDebugger{}.Call(target)
+			if err != nil {
+				j.log().Debug("failed resuming attached target", zap.Error(err), zap.String("url", e.TargetInfo.URL))
+			}
+		},
+		func(e *proto.TargetDetachedFromTarget) {
+			lock.Lock()
+			defer lock.Unlock()
+			delete(sessions, e.SessionID)
+		},
+		func(e *proto.RuntimeBindingCalled, sessionID proto.TargetSessionID) {
+			if !ours(sessionID) {
+				return
+			}
+			if h, ok := handlers[e.Name]; ok {
+				h(e.Payload)
+			}
+		},
+	)
+	j.installInstrumentation(page, instrumentations)
+	j.goRunning(wait)
+	return cancel
+}
+
+// installInstrumentation adds the bindings and scripts to the tab or iframe of page, and makes its cross-origin iframes
+// attach so they can be instrumented as well
+func (j *Job) installInstrumentation(page *rod.Page, instrumentations []instrumentation) {
+	//The binding calls are runtime events
+	err := proto.RuntimeEnable{}.Call(page)
+	if err != nil {
+		j.log().Error("failed enabling runtime events", zap.Error(err))
+	}
+
+	for _, i := range instrumentations {
+		err := proto.RuntimeAddBinding{Name: i.binding}.Call(page)
+		if err != nil {
+			j.log().Error("failed adding binding", zap.Error(err), zap.String("binding", i.binding))
+			continue
+		}
+
+		_, err = page.EvalOnNewDocument(i.script)
+		if err != nil {
+			j.log().Error("failed injecting script", zap.Error(err), zap.String("binding", i.binding))
+		}
+	}
+
+	err = proto.TargetSetAutoAttach{AutoAttach: true, WaitForDebuggerOnStart: true, Flatten: true}.Call(page)
+	if err != nil {
+		j.log().Error("failed attaching to iframes", zap.Error(err))
+	}
+}
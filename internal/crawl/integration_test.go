@@ -0,0 +1,196 @@
+package crawl
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlfredBerg/rod-crawler/hooks"
+	"github.com/AlfredBerg/rod-crawler/internal/fixture"
+	"github.com/AlfredBerg/rod-crawler/internal/outputHandlers/sqlite"
+	"github.com/AlfredBerg/rod-crawler/internal/params"
+	"github.com/go-rod/rod"
+)
+
+// skipLogout is a hook that never clicks logout buttons
+type skipLogout struct {
+	hooks.NoopHooks
+}
+
+func (skipLogout) BeforeClick(page *rod.Page, element *rod.Element, xpath string) bool {
+	text, err := element.Text()
+	return err != nil || !strings.Contains(strings.ToLower(text), "logout")
+}
+
+func TestCrawlFixture(t *testing.T) {
+	browser := testBrowser(t)
+
+	site := fixture.New()
+	defer site.Close()
+
+	tests := []struct {
+		page string
+		//Paths that must have been requested by the crawl
+		requested []string
+		//Paths that must not have been requested by the crawl
+		notRequested []string
+		hooks        hooks.Hooks
+		//Paths the crawler should request but doesn't yet, they are only logged so the coverage can be followed
+		gaps []string
+	}{
+		{page: "/links", requested: []string{"/links", "/links/target"}},
+		{page: "/buttons", requested: []string{"/api/button", "/api/div", "/api/listener"}},
+		{page: "/forms", requested: []string{"/search"}},
+		{page: "/spa", requested: []string{"/api/settings"}},
+		//Tabs opened with window.open are closed without being crawled
+		{page: "/popup", requested: []string{"/popup"}, gaps: []string{"/api/popup"}},
+		{page: "/iframe", requested: []string{"/iframe/content", "/api/iframe-load"}, gaps: []string{"/api/iframe-click"}},
+		//Elements in shadow roots are not found
+		{page: "/shadow", requested: []string{"/shadow"}, gaps: []string{"/api/shadow"}},
+		{page: "/scope", notRequested: []string{"/api/outside"}},
+		{page: "/logout", requested: []string{"/api/profile"}, notRequested: []string{"/logout/done"}, hooks: skipLogout{}},
+		{page: "/stream", requested: []string{"/api/poll", "/api/after-poll"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.TrimPrefix(tt.page, "/"), func(t *testing.T) {
+			db := filepath.Join(t.TempDir(), "req.db")
+			output := &sqlite.SqliteOutput{Database: db}
+			err := output.Init()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			incognito, err := browser.Incognito()
+			if err != nil {
+				t.Fatalf("failed creating browser context: %s", err)
+			}
+			defer incognito.Close()
+
+			j := Job{Browser: incognito, Target: site.URL(tt.page), CrawlTimeout: time.Second * 30, OutputHandler: output, Scope: []string{"127.0.0.1"},
+				Budget: Budget{StabilityWait: time.Second * 3, MaxActions: 20}, Hooks: tt.hooks}
+			j.Crawl(context.Background(), true)
+			output.Cleanup()
+
+			requested := requestedPaths(t, db)
+			for _, p := range tt.requested {
+				if !requested[p] {
+					t.Errorf("%s was not requested, requested: %v", p, requested)
+				}
+			}
+			for _, p := range tt.notRequested {
+				//The sites are asked as well, in case a request was made but not saved
+				if requested[p] || site.Hits(p) != 0 {
+					t.Errorf("%s was requested", p)
+				}
+			}
+			for _, p := range tt.gaps {
+				t.Logf("known gap %s requested: %t", p, requested[p])
+			}
+		})
+	}
+}
+
+func TestCrawlFixtureParameters(t *testing.T) {
+	browser := testBrowser(t)
+
+	site := fixture.New()
+	defer site.Close()
+
+	db := filepath.Join(t.TempDir(), "req.db")
+	output := &sqlite.SqliteOutput{Database: db}
+	err := output.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	j := Job{Browser: browser, Target: site.URL("/forms"), CrawlTimeout: time.Second * 30, OutputHandler: output, Scope: []string{"127.0.0.1"},
+		Budget: Budget{StabilityWait: time.Second * 3, MaxActions: 20}}
+	j.Crawl(context.Background(), false)
+	output.Cleanup()
+
+	found := false
+	err = sqlite.ReadParameters(db, func(p params.Parameter) error {
+		if p.Path == "/search" && p.Location == "query" && p.Name == "q" {
+			found = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found {
+		t.Error("the q parameter of the search form was not saved")
+	}
+}
+
+func TestCrawlInstrumentsCrossOriginIframes(t *testing.T) {
+	browser := testBrowser(t)
+
+	site := fixture.New()
+	defer site.Close()
+
+	db := filepath.Join(t.TempDir(), "req.db")
+	output := &sqlite.SqliteOutput{Database: db}
+	err := output.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	j := Job{Browser: browser, Target: site.URL("/iframe/cross"), CrawlTimeout: time.Second * 30, OutputHandler: output, Scope: []string{"127.0.0.1"},
+		Budget: Budget{StabilityWait: time.Second * 3, MaxActions: 5}}
+	j.Crawl(context.Background(), false)
+	output.Cleanup()
+
+	sqlDb, err := sql.Open("sqlite3", db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDb.Close()
+
+	var listeners int
+	err = sqlDb.QueryRow(`SELECT count(*) FROM postmessages WHERE json_extract(postmessage, '$.kind') = 'listener'
+		AND json_extract(postmessage, '$.frame') LIKE '%/outside/frame';`).Scan(&listeners)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if listeners == 0 {
+		t.Error("the message listener of the cross-origin iframe was not saved")
+	}
+}
+
+// requestedPaths returns the paths of the requests saved in the database
+func requestedPaths(t *testing.T, database string) map[string]bool {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT json_extract(request, '$.url') FROM requests;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	paths := map[string]bool{}
+	for rows.Next() {
+		var raw string
+		err = rows.Scan(&raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, err := url.Parse(raw)
+		if err != nil {
+			continue
+		}
+		paths[u.Path] = true
+	}
+	return paths
+}
@@ -1,20 +1,118 @@
 package crawl
 
 import (
+	"context"
+	"net/http"
+	"sync"
 	"time"
 
-	"github.com/AlfredBerg/rod-crawler/internal/outputHandlers/sqlite"
+	"github.com/AlfredBerg/rod-crawler/hooks"
+	"github.com/AlfredBerg/rod-crawler/internal/frontier"
+	"github.com/AlfredBerg/rod-crawler/internal/js"
+	"github.com/AlfredBerg/rod-crawler/internal/metrics"
+	"github.com/AlfredBerg/rod-crawler/internal/params"
+	"github.com/AlfredBerg/rod-crawler/internal/sourcemap"
 	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+	"go.uber.org/zap"
 )
 
 type Job struct {
-	Browser       *rod.Browser
-	Target        string
+	Browser *rod.Browser
+	Target  string
+	//How many crawls deep the target was found, 0 for the targets given by the user
+	Depth int
+	//How many times the target has been crawled, including this time. Saved in the result.
+	Attempt       int
 	CrawlTimeout  time.Duration
-	OutputHandler *sqlite.SqliteOutput
+	Budget        Budget
+	OutputHandler Output
 
 	//The current browser url of the page being crawled must match one of these or a subdomain of them
 	Scope []string
 
+	//Urls found in the dom and in requests are queued here as new targets, nil disables it
+	Frontier *frontier.Frontier
+
+	//The source maps of in scope scripts are downloaded and saved with this, nil disables it
+	SourceMaps *sourcemap.Fetcher
+
+	//The parameters of in scope requests, forms and cookies are collected here, nil disables it
+	Params *params.Inventory
+
+	Emulation Emulation
+	//Extra headers sent with every request, e.g. for authentication
+	Headers map[string]string
+
+	//If sources reaching DOM XSS sinks should be traced and saved as findings
+	DomXss bool
+	//If the parameters of each page state should be requested with canaries to find where they are reflected
+	Reflection bool
+	//User provided scripts evaluated on every page state
+	Snippets []js.Snippet
+	//Called around the crawl lifecycle, nil disables it
+	Hooks hooks.Hooks
+	//Used for the logs of the crawl, the global logger is used if nil
+	Logger *zap.Logger
+
+	//The context given to Crawl
+	ctx context.Context
+	//The context of the crawl's tab, it is also done when the crawl timeout is reached
+	pageCtx context.Context
+	//Keyed by the page state and the xpath of the element
 	clickedElements map[string]int
+	//The url of the current page state as reported by js.ROUTE_HOOK
+	route     string
+	routeLock sync.Mutex
+	//The page urls and parameters that have been probed for reflections
+	probed map[string]bool
+	//The page states the snippets have been run on
+	snippetStates map[string]bool
+	client        *http.Client
+	//The requests waiting for their response when responses are saved, see captureResponses
+	responses *responseCapture
+	//Work started by the crawl that must be done before the crawl is done
+	background tasks
+	//Go routines that run until the crawl is done, e.g. event listeners. They stop when the crawl's context is canceled.
+	running sync.WaitGroup
+	metrics *metrics.Collector
+	//Why the crawl stopped early, saved in the result
+	err error
+	//Why the browser was lost, see watchCrash
+	crashErr  error
+	crashLock sync.Mutex
+}
+
+// Emulation overrides applied to the crawling tab before the target is navigated to
+type Emulation struct {
+	//IANA timezone id, e.g. Europe/Stockholm
+	Timezone string
+	//ICU style locale, e.g. sv_SE
+	Locale      string
+	Geolocation *proto.EmulationSetGeolocationOverride
+}
+
+// hooks returns the hooks of the job, nil means no hooks
+func (j *Job) hooks() hooks.Hooks {
+	if j.Hooks == nil {
+		return hooks.NoopHooks{}
+	}
+	return j.Hooks
+}
+
+// log returns the logger of the job, nil means the global logger
+func (j *Job) log() *zap.Logger {
+	if j.Logger == nil {
+		return zap.L()
+	}
+	return j.Logger
+}
+
+// goRunning runs fn in a go routine that Crawl waits for before it returns, fn must return when the crawl's context is canceled
+func (j *Job) goRunning(fn func()) {
+	j.running.Add(1)
+	go func() {
+		defer j.running.Done()
+		fn()
+	}()
 }
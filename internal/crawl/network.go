@@ -0,0 +1,100 @@
+package crawl
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+	"go.uber.org/zap"
+)
+
+// watchNetwork records the traffic of the tab that the request hijacking can't see, stop must be called when the crawl is done
+func (j *Job) watchNetwork(page *rod.Page) (stop func()) {
+	//The frame and message events only have the request id, not the url of the websocket or event source.
+	//Their timestamps are monotonic, the wall time given when the stream was requested is used to convert them.
+	type stream struct {
+		url string
+		//The wall time of monotonic time 0
+		clock time.Time
+	}
+	var lock sync.Mutex
+	streams := map[proto.NetworkRequestID]stream{}
+	setStream := func(id proto.NetworkRequestID, url string, wallTime proto.TimeSinceEpoch, timestamp proto.MonotonicTime) {
+		lock.Lock()
+		defer lock.Unlock()
+		s := streams[id]
+		if url != "" {
+			s.url = url
+		}
+		if wallTime != 0 {
+			s.clock = wallTime.Time().Add(-timestamp.Duration())
+		}
+		streams[id] = s
+	}
+	requestURL := func(id proto.NetworkRequestID) string {
+		lock.Lock()
+		defer lock.Unlock()
+		return streams[id].url
+	}
+	at := func(id proto.NetworkRequestID, timestamp proto.MonotonicTime) time.Time {
+		lock.Lock()
+		defer lock.Unlock()
+		if streams[id].clock.IsZero() {
+			return time.Now()
+		}
+		return streams[id].clock.Add(timestamp.Duration())
+	}
+
+	ctx, cancel := context.WithCancel(page.GetContext())
+	j.goRunning(page.Context(ctx).EachEvent(
+		func(e *proto.NetworkWebSocketCreated) {
+			setStream(e.RequestID, e.URL, 0, 0)
+			j.log().Debug("websocket created", zap.String("url", e.URL))
+			//The only event without a timestamp
+			j.OutputHandler.HandleWebSocket(string(e.RequestID), e.URL, j.currentRoute(page), "created", "", 0, "", nil, time.Now())
+		},
+		func(e *proto.NetworkWebSocketWillSendHandshakeRequest) {
+			setStream(e.RequestID, "", e.WallTime, e.Timestamp)
+			j.OutputHandler.HandleWebSocket(string(e.RequestID), requestURL(e.RequestID), j.currentRoute(page), "handshake_request", "sent", 0, "",
+				headers(e.Request.Headers), e.WallTime.Time())
+		},
+		func(e *proto.NetworkWebSocketHandshakeResponseReceived) {
+			j.OutputHandler.HandleWebSocket(string(e.RequestID), requestURL(e.RequestID), j.currentRoute(page), "handshake_response", "received", 0, "",
+				headers(e.Response.Headers), at(e.RequestID, e.Timestamp))
+		},
+		func(e *proto.NetworkWebSocketFrameSent) {
+			j.OutputHandler.HandleWebSocket(string(e.RequestID), requestURL(e.RequestID), j.currentRoute(page), "frame", "sent",
+				int(e.Response.Opcode), e.Response.PayloadData, nil, at(e.RequestID, e.Timestamp))
+		},
+		func(e *proto.NetworkWebSocketFrameReceived) {
+			j.OutputHandler.HandleWebSocket(string(e.RequestID), requestURL(e.RequestID), j.currentRoute(page), "frame", "received",
+				int(e.Response.Opcode), e.Response.PayloadData, nil, at(e.RequestID, e.Timestamp))
+		},
+		func(e *proto.NetworkWebSocketClosed) {
+			j.OutputHandler.HandleWebSocket(string(e.RequestID), requestURL(e.RequestID), j.currentRoute(page), "closed", "", 0, "", nil,
+				at(e.RequestID, e.Timestamp))
+		},
+		func(e *proto.NetworkRequestWillBeSent) {
+			if e.Type == proto.NetworkResourceTypeEventSource {
+				setStream(e.RequestID, e.Request.URL, e.WallTime, e.Timestamp)
+			}
+		},
+		func(e *proto.NetworkEventSourceMessageReceived) {
+			j.OutputHandler.HandleEventSourceMessage(string(e.RequestID), requestURL(e.RequestID), j.currentRoute(page), e.EventName, e.EventID, e.Data,
+				at(e.RequestID, e.Timestamp))
+		},
+	))
+	return cancel
+}
+
+// headers converts devtools headers, where repeated headers are joined by newlines, to the same format as http.Header
+func headers(h proto.NetworkHeaders) map[string][]string {
+	res := map[string][]string{}
+	for name, value := range h {
+		res[name] = strings.Split(value.Str(), "\n")
+	}
+	return res
+}
@@ -0,0 +1,30 @@
+package crawl
+
+import (
+	"time"
+
+	"github.com/AlfredBerg/rod-crawler/internal/metrics"
+	"github.com/AlfredBerg/rod-crawler/internal/params"
+)
+
+// Output is where everything found while crawling is saved, sqlite.SqliteOutput is the default one.
+// The methods are called by multiple go routines at the same time.
+type Output interface {
+	HandleRequest(transactionIdentifier, origin, method, body, url, path, raw, host string, headers map[string][]string) error
+	HandleResponse(transactionIdentifier, body, statusLine string, statusCode int, headers map[string][]string) error
+	HandleSeed(url, source, origin string) error
+	HandleEndpoint(source, kind, method, value string, offset int) error
+	HandleSourceMap(script, url, content string) error
+	HandleRoute(target, url, kind string) error
+	//timestamp is when the browser saw the event
+	HandleWebSocket(requestIdentifier, url, origin, event, direction string, opcode int, payload string, headers map[string][]string, timestamp time.Time) error
+	HandleEventSourceMessage(requestIdentifier, url, origin, event, eventIdentifier, data string, timestamp time.Time) error
+	HandlePostMessage(origin, frame, kind, messageOrigin, targetOrigin, shape, data, listener, stack string) error
+	//detail must be json
+	HandleFinding(findingType, origin, title, detail string) error
+	HandleReflection(origin, url, method, param, canary, context, location string) error
+	//Called again for the same parameter when it gets new sample values
+	HandleParameter(p params.Parameter) error
+	//Called once per target with how its last crawl went and its coverage metrics, also for targets that could not be crawled at all
+	HandleResult(r metrics.Result) error
+}
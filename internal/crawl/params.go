@@ -0,0 +1,77 @@
+package crawl
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/AlfredBerg/rod-crawler/internal/js"
+	"github.com/AlfredBerg/rod-crawler/internal/params"
+	"github.com/AlfredBerg/rod-crawler/internal/scope"
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+	"go.uber.org/zap"
+)
+
+// requestParams adds the query, body, cookie and header parameters of an in scope request to the inventory
+func (j *Job) requestParams(req *http.Request, body, origin string) {
+	if j.Params == nil || !scope.InScope(req.URL.Hostname(), j.Scope) {
+		return
+	}
+
+	found := params.FromQuery(req.URL)
+	found = append(found, params.FromBody(req.Header.Get("Content-Type"), body)...)
+	found = append(found, params.FromCookies(req.Header.Get("Cookie"))...)
+	found = append(found, params.FromHeaders(req.Header)...)
+	j.addParams(req.URL, "request", origin, found)
+}
+
+// pageParams adds the inputs of the page state's in scope forms and the cookies the browser has for it to the inventory
+func (j *Job) pageParams(page *rod.Page, state string) {
+	if j.Params == nil {
+		return
+	}
+
+	res, err := page.Eval(js.GET_INPUT_PARAMS)
+	if err != nil {
+		j.log().Error("error getting parameters", zap.Error(err))
+	} else {
+		for _, p := range res.Value.Arr() {
+			action, err := url.Parse(p.Get("action").Str())
+			if err != nil {
+				j.log().Error("failed parsing form action", zap.Error(err), zap.String("url", p.Get("action").Str()))
+				continue
+			}
+			//A form can submit to any site
+			if !scope.InScope(action.Hostname(), j.Scope) {
+				continue
+			}
+			location := "query"
+			if strings.EqualFold(p.Get("method").Str(), http.MethodPost) {
+				location = "body"
+			}
+			j.addParams(action, "form", state, []params.Found{{Location: location, Name: p.Get("name").Str(), Value: p.Get("value").Str()}})
+		}
+	}
+
+	stateUrl, err := url.Parse(state)
+	if err != nil {
+		return
+	}
+	cookies, err := proto.NetworkGetCookies{Urls: []string{state}}.Call(page)
+	if err != nil {
+		j.log().Error("failed getting cookies", zap.Error(err))
+		return
+	}
+	found := []params.Found{}
+	for _, c := range cookies.Cookies {
+		found = append(found, params.Found{Location: "cookie", Name: c.Name, Value: c.Value})
+	}
+	j.addParams(stateUrl, "cookies", state, found)
+}
+
+func (j *Job) addParams(u *url.URL, source, origin string, found []params.Found) {
+	for _, p := range j.Params.Add(u, source, origin, found) {
+		j.OutputHandler.HandleParameter(p)
+	}
+}
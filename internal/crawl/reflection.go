@@ -0,0 +1,139 @@
+package crawl
+
+import (
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AlfredBerg/rod-crawler/internal/js"
+	"github.com/AlfredBerg/rod-crawler/internal/reflection"
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+	"go.uber.org/zap"
+)
+
+// Never read more than this from a probe response
+const maxProbeBodySize = 10 * 1024 * 1024
+
+// findReflections requests the page state with a unique canary in every parameter of the page, both as GET and POST, and saves
+// where the canaries are reflected in the responses and in the dom rendered from the GET url. Every page and set of parameters
+// is only probed once.
+func (j *Job) findReflections(page *rod.Page, state string) {
+	res, err := page.Eval(js.GET_PARAM_NAMES)
+	if err != nil {
+		j.log().Error("error getting parameter names", zap.Error(err))
+		return
+	}
+	params := []string{}
+	for _, p := range res.Value.Arr() {
+		params = append(params, p.Str())
+	}
+	if len(params) == 0 {
+		return
+	}
+	sort.Strings(params)
+
+	pageUrl, _, _ := strings.Cut(state, "#")
+	key := pageUrl + " " + strings.Join(params, "&")
+	if j.probed[key] {
+		return
+	}
+	j.probed[key] = true
+
+	//Send the session cookies of the browser so the probes see the same thing as the crawler
+	cookies, err := proto.NetworkGetCookies{Urls: []string{pageUrl}}.Call(page)
+	if err != nil {
+		j.log().Error("failed getting cookies for reflection probes", zap.Error(err))
+		return
+	}
+	cookieHeader := []string{}
+	for _, c := range cookies.Cookies {
+		cookieHeader = append(cookieHeader, c.Name+"="+c.Value)
+	}
+
+	canaries := reflection.Canaries(params)
+	getUrl, err := reflection.WithQuery(pageUrl, canaries)
+	if err != nil {
+		j.log().Error("failed building reflection probe url", zap.Error(err), zap.String("url", pageUrl))
+		return
+	}
+
+	j.background.Go(func() {
+		body, err := j.probe(http.MethodGet, getUrl, "", strings.Join(cookieHeader, "; "))
+		if err != nil {
+			j.log().Debug("reflection probe failed", zap.Error(err), zap.String("url", getUrl))
+		} else {
+			j.saveReflections(state, getUrl, http.MethodGet, "response", reflection.Find(body, canaries))
+		}
+
+		body, err = j.probe(http.MethodPost, pageUrl, reflection.Query(canaries), strings.Join(cookieHeader, "; "))
+		if err != nil {
+			j.log().Debug("reflection probe failed", zap.Error(err), zap.String("url", pageUrl))
+		} else {
+			j.saveReflections(state, pageUrl, http.MethodPost, "response", reflection.Find(body, canaries))
+		}
+
+		html, err := j.render(getUrl)
+		if err != nil {
+			j.log().Debug("failed rendering reflection probe", zap.Error(err), zap.String("url", getUrl))
+		} else {
+			j.saveReflections(state, getUrl, http.MethodGet, "dom", reflection.Find(html, canaries))
+		}
+	})
+}
+
+func (j *Job) probe(method, u, body, cookies string) (string, error) {
+	req, err := http.NewRequestWithContext(j.ctx, method, u, strings.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	if method == http.MethodPost {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if cookies != "" {
+		req.Header.Set("Cookie", cookies)
+	}
+	for name, value := range j.Headers {
+		req.Header.Set(name, value)
+	}
+
+	res, err := j.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(res.Body, maxProbeBodySize))
+	return string(b), err
+}
+
+// render returns the dom of u after it has been loaded in a new tab of the crawl's browser
+func (j *Job) render(u string) (string, error) {
+	page, err := j.Browser.Page(proto.TargetCreateTarget{})
+	if err != nil {
+		return "", err
+	}
+	defer page.Close()
+	j.setupPage(page)
+
+	page = page.Timeout(time.Second * 10)
+	err = page.Navigate(u)
+	if err != nil {
+		return "", err
+	}
+	err = page.WaitLoad()
+	if err != nil {
+		return "", err
+	}
+	return page.HTML()
+}
+
+func (j *Job) saveReflections(origin, u, method, location string, reflections []reflection.Reflection) {
+	for _, r := range reflections {
+		j.log().Info("parameter reflected", zap.String("param", r.Param), zap.String("context", r.Context), zap.String("url", u),
+			zap.String("method", method), zap.String("in", location))
+		j.OutputHandler.HandleReflection(origin, u, method, r.Param, r.Canary, r.Context, location)
+	}
+}
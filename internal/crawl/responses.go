@@ -0,0 +1,286 @@
+package crawl
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+	"go.uber.org/zap"
+)
+
+// Responses are saved at the response stage of the request interception, when the browser has received the headers.
+// Streams, e.g. server-sent events or long polling, never end so they can't be buffered. They are passed through
+// untouched and saved when they end.
+
+// Content types of responses that are streamed, e.g. server-sent events or newline delimited json
+var streamingContentTypes = []string{"text/event-stream", "application/x-ndjson", "application/stream+json", "multipart/x-mixed-replace"}
+
+// Headers that describe how the body was sent, they don't apply to the decoded body the browser is fulfilled with
+var transferHeaders = map[string]bool{"Content-Encoding": true, "Content-Length": true, "Transfer-Encoding": true}
+
+// capturedRequest is a saved request waiting for its response
+type capturedRequest struct {
+	transaction string
+	origin      string
+	url         string
+	script      bool
+	//If the source map of the script should be looked for
+	sourceMap bool
+}
+
+// streamedResponse is a response that is passed through to the browser, it is saved when it ends
+type streamedResponse struct {
+	capturedRequest
+	code    int
+	phrase  string
+	headers http.Header
+}
+
+// responseCapture keeps the state of the requests between their request and response stage
+type responseCapture struct {
+	//Done when the capture is stopped, nothing waits for paused events after that
+	ctx  context.Context
+	lock sync.Mutex
+	//The hijack context of the router doesn't tell the stage of the request, so the paused events are kept by the
+	//request id until the router's handler takes them
+	paused   map[proto.FetchRequestID]chan *proto.FetchRequestPaused
+	requests map[string]capturedRequest
+	streams  map[proto.NetworkRequestID]streamedResponse
+}
+
+func newResponseCapture(ctx context.Context) *responseCapture {
+	return &responseCapture{ctx: ctx, paused: map[proto.FetchRequestID]chan *proto.FetchRequestPaused{},
+		requests: map[string]capturedRequest{}, streams: map[proto.NetworkRequestID]streamedResponse{}}
+}
+
+func (c *responseCapture) pausedChan(id proto.FetchRequestID) chan *proto.FetchRequestPaused {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	ch, ok := c.paused[id]
+	if !ok {
+		//A request is paused again only after it was continued, so there is never more than one event waiting
+		ch = make(chan *proto.FetchRequestPaused, 1)
+		c.paused[id] = ch
+	}
+	return ch
+}
+
+func (c *responseCapture) addPaused(e *proto.FetchRequestPaused) {
+	c.pausedChan(e.RequestID) <- e
+}
+
+// takePaused waits for the paused event of the request, nil is returned if the capture is stopped first
+func (c *responseCapture) takePaused(id proto.FetchRequestID) *proto.FetchRequestPaused {
+	select {
+	case e := <-c.pausedChan(id):
+		c.lock.Lock()
+		delete(c.paused, id)
+		c.lock.Unlock()
+		return e
+	case <-c.ctx.Done():
+		return nil
+	}
+}
+
+func (c *responseCapture) addRequest(e *proto.FetchRequestPaused, r capturedRequest) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.requests[requestKey(e)] = r
+}
+
+func (c *responseCapture) takeRequest(e *proto.FetchRequestPaused) (capturedRequest, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	r, ok := c.requests[requestKey(e)]
+	delete(c.requests, requestKey(e))
+	return r, ok
+}
+
+func (c *responseCapture) addStream(id proto.NetworkRequestID, s streamedResponse) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.streams[id] = s
+}
+
+func (c *responseCapture) takeStream(id proto.NetworkRequestID) (streamedResponse, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	s, ok := c.streams[id]
+	delete(c.streams, id)
+	return s, ok
+}
+
+// takeStreams returns the streams that have not ended
+func (c *responseCapture) takeStreams() []streamedResponse {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	streams := []streamedResponse{}
+	for id, s := range c.streams {
+		streams = append(streams, s)
+		delete(c.streams, id)
+	}
+	return streams
+}
+
+// requestKey is the same for both stages of a request, the network id is only missing if the network events are disabled
+func requestKey(e *proto.FetchRequestPaused) string {
+	if e.NetworkID != "" {
+		return string(e.NetworkID)
+	}
+	return string(e.RequestID)
+}
+
+// atResponseStage tells if the request was paused after its response was received, or after it failed
+func atResponseStage(e *proto.FetchRequestPaused) bool {
+	return e.ResponseStatusCode != nil || e.ResponseErrorReason != ""
+}
+
+// isStreamingResponse tells if the response may never end, e.g. server-sent events or a chunked long poll
+func isStreamingResponse(headers http.Header) bool {
+	contentType := headers.Get("Content-Type")
+	for _, t := range streamingContentTypes {
+		if strings.Contains(contentType, t) {
+			return true
+		}
+	}
+	return headers.Get("Content-Length") == "" && strings.Contains(strings.ToLower(headers.Get("Transfer-Encoding")), "chunked")
+}
+
+func fetchHeaders(entries []*proto.FetchHeaderEntry) http.Header {
+	h := http.Header{}
+	for _, e := range entries {
+		h.Add(e.Name, e.Value)
+	}
+	return h
+}
+
+// captureResponses pauses the requests of the tab again when their response headers are received, and records the events
+// the router's handler needs. It must be called after the router's handler is added, and before the router runs.
+// stop must be called when the crawl is done, the streams that have not ended are saved without a body.
+func (j *Job) captureResponses(page *rod.Page) (stop func(), err error) {
+	//Replaces the patterns of the router, which only pauses requests before they are sent
+	err = proto.FetchEnable{Patterns: []*proto.FetchRequestPattern{
+		{URLPattern: "*", RequestStage: proto.FetchRequestStageRequest},
+		{URLPattern: "*", RequestStage: proto.FetchRequestStageResponse},
+	}}.Call(page)
+	if err != nil {
+		return nil, err
+	}
+
+	//The Fetch domain is enabled, so listening to its events doesn't enable it again without the patterns
+	ctx, cancel := context.WithCancel(page.GetContext())
+	j.responses = newResponseCapture(ctx)
+	j.goRunning(page.Context(ctx).EachEvent(
+		func(e *proto.FetchRequestPaused) {
+			j.responses.addPaused(e)
+		},
+		func(e *proto.NetworkLoadingFinished) {
+			s, ok := j.responses.takeStream(e.RequestID)
+			if !ok {
+				return
+			}
+			//Getting the body is a call to the browser, which can't be made from the event loop
+			j.background.Go(func() {
+				body, err := proto.NetworkGetResponseBody{RequestID: e.RequestID}.Call(page)
+				if err != nil {
+					j.log().Debug("failed getting the body of a streamed response", zap.Error(err), zap.String("url", s.url))
+					j.saveResponse(s.capturedRequest, s.code, s.phrase, s.headers, "")
+					return
+				}
+				j.saveResponse(s.capturedRequest, s.code, s.phrase, s.headers, decodeBody(body.Body, body.Base64Encoded))
+			})
+		},
+		func(e *proto.NetworkLoadingFailed) {
+			if s, ok := j.responses.takeStream(e.RequestID); ok {
+				j.saveResponse(s.capturedRequest, s.code, s.phrase, s.headers, "")
+			}
+		},
+	))
+
+	return func() {
+		cancel()
+		for _, s := range j.responses.takeStreams() {
+			j.saveResponse(s.capturedRequest, s.code, s.phrase, s.headers, "")
+		}
+	}, nil
+}
+
+// onResponse handles a request paused at the response stage. Streams are passed through, other responses are buffered
+// so the hooks get the whole response.
+func (j *Job) onResponse(page *rod.Page, ctx *rod.Hijack, e *proto.FetchRequestPaused) {
+	r, ok := j.responses.takeRequest(e)
+	if !ok || e.ResponseStatusCode == nil {
+		//The request was not saved, or it failed and there is no response
+		ctx.ContinueRequest(&proto.FetchContinueRequest{})
+		return
+	}
+
+	headers := fetchHeaders(e.ResponseHeaders)
+	if isStreamingResponse(headers) {
+		j.responses.addStream(e.NetworkID, streamedResponse{capturedRequest: r, code: *e.ResponseStatusCode, phrase: e.ResponseStatusText, headers: headers})
+		ctx.ContinueRequest(&proto.FetchContinueRequest{})
+		return
+	}
+
+	body, err := proto.FetchGetResponseBody{RequestID: e.RequestID}.Call(page)
+	if err != nil {
+		j.log().Error("failed getting response body", zap.Error(err), zap.String("url", r.url))
+		ctx.ContinueRequest(&proto.FetchContinueRequest{})
+		return
+	}
+
+	//The browser is fulfilled with the response as it is, except for the body being decoded
+	payload := ctx.Response.Payload()
+	payload.ResponseCode = *e.ResponseStatusCode
+	payload.ResponsePhrase = e.ResponseStatusText
+	payload.ResponseHeaders = nil
+	for _, h := range e.ResponseHeaders {
+		if !transferHeaders[http.CanonicalHeaderKey(h.Name)] {
+			payload.ResponseHeaders = append(payload.ResponseHeaders, h)
+		}
+	}
+	payload.Body = []byte(decodeBody(body.Body, body.Base64Encoded))
+
+	j.saveResponse(r, payload.ResponseCode, payload.ResponsePhrase, ctx.Response.Headers(), ctx.Response.Body())
+	j.hooks().OnResponse(ctx, r.origin)
+}
+
+// saveResponse saves the response of a request and looks for endpoints and the source map in scripts
+func (j *Job) saveResponse(r capturedRequest, code int, phrase string, headers http.Header, body string) {
+	j.OutputHandler.HandleResponse(r.transaction, body, phrase, code, headers)
+
+	if isJavascript(r.script, headers) {
+		j.background.Go(func() {
+			j.extractEndpoints(r.url, body)
+		})
+	}
+	if r.sourceMap {
+		j.background.Go(func() {
+			//A stream that didn't end has no body, the script is downloaded again
+			j.sourceMap(r.url, headers, body, body != "")
+		})
+	}
+}
+
+func decodeBody(body string, base64Encoded bool) string {
+	if !base64Encoded {
+		return body
+	}
+	b, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return body
+	}
+	return string(b)
+}
+
+func isJavascript(script bool, headers http.Header) bool {
+	if script {
+		return true
+	}
+	contentType := headers.Get("Content-Type")
+	return strings.Contains(contentType, "javascript") || strings.Contains(contentType, "ecmascript")
+}
@@ -0,0 +1,28 @@
+package crawl
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestIsStreamingResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers http.Header
+		want    bool
+	}{
+		{"event stream", http.Header{"Content-Type": {"text/event-stream; charset=utf-8"}}, true},
+		{"ndjson", http.Header{"Content-Type": {"application/x-ndjson"}, "Content-Length": {"10"}}, true},
+		{"chunked", http.Header{"Content-Type": {"application/json"}, "Transfer-Encoding": {"chunked"}}, true},
+		{"chunked with length", http.Header{"Transfer-Encoding": {"chunked"}, "Content-Length": {"10"}}, false},
+		{"with length", http.Header{"Content-Type": {"application/json"}, "Content-Length": {"10"}}, false},
+		{"html", http.Header{"Content-Type": {"text/html"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isStreamingResponse(tt.headers); got != tt.want {
+				t.Errorf("isStreamingResponse(%v) = %t, want %t", tt.headers, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package crawl
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/AlfredBerg/rod-crawler/internal/js"
+	"github.com/go-rod/rod"
+	"go.uber.org/zap"
+)
+
+// runSnippets evaluates the user provided snippets on a page state, the findings they return are saved and the urls are queued
+// as new targets. Every snippet is only run once per page state.
+func (j *Job) runSnippets(page *rod.Page, state string) {
+	if len(j.Snippets) == 0 || j.snippetStates[state] {
+		return
+	}
+	j.snippetStates[state] = true
+
+	for _, s := range j.Snippets {
+		j.runSnippet(page, state, s)
+	}
+}
+
+func (j *Job) runSnippet(page *rod.Page, state string, s js.Snippet) {
+	res, err := page.Timeout(time.Second * 5).Eval(s.Script)
+	if err != nil {
+		j.log().Error("snippet failed", zap.Error(err), zap.String("snippet", s.Name), zap.String("url", state))
+		return
+	}
+
+	var result struct {
+		Findings []struct {
+			Title  string          `json:"title"`
+			Detail json.RawMessage `json:"detail"`
+		} `json:"findings"`
+		Urls []string `json:"urls"`
+	}
+	if res.Value.Nil() {
+		return
+	}
+	err = res.Value.Unmarshal(&result)
+	if err != nil {
+		j.log().Error("snippet returned an invalid result", zap.Error(err), zap.String("snippet", s.Name), zap.String("result", res.Value.String()))
+		return
+	}
+
+	for _, f := range result.Findings {
+		j.log().Info("snippet finding", zap.String("snippet", s.Name), zap.String("title", f.Title), zap.String("url", state))
+		j.OutputHandler.HandleFinding("snippet:"+s.Name, state, f.Title, string(f.Detail))
+	}
+	for _, u := range result.Urls {
+		j.harvest(u, "snippet:"+s.Name)
+	}
+}
@@ -0,0 +1,46 @@
+package crawl
+
+import "sync"
+
+// tasks tracks the work started by a job, e.g. hijacked requests and background downloads, so the job can wait for it
+// before it is done. Once closed no new tasks are started, which makes it safe to start tasks from event handlers that
+// may still be called while the job is being torn down.
+type tasks struct {
+	lock   sync.Mutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// start registers a task, false is returned if the tasks are closed and the task must not run
+func (t *tasks) start() bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.closed {
+		return false
+	}
+	t.wg.Add(1)
+	return true
+}
+
+func (t *tasks) done() {
+	t.wg.Done()
+}
+
+// Go runs fn in a new go routine as a task
+func (t *tasks) Go(fn func()) {
+	if !t.start() {
+		return
+	}
+	go func() {
+		defer t.done()
+		fn()
+	}()
+}
+
+// close stops new tasks from starting and waits for the running ones
+func (t *tasks) close() {
+	t.lock.Lock()
+	t.closed = true
+	t.lock.Unlock()
+	t.wg.Wait()
+}
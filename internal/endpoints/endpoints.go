@@ -0,0 +1,123 @@
+package endpoints
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Endpoint is an url, path or api operation found in javascript
+type Endpoint struct {
+	//The url, path or graphql operation
+	Value string
+	//How it was found, e.g. fetch, axios, xhr, jquery, graphql, route or path
+	Kind string
+	//The http method if it is known from the call, otherwise empty
+	Method string
+	//Byte offset of the value in the javascript file
+	Offset int
+}
+
+// A string literal in any of the three javascript quote styles, the value is in one of the three groups
+const quoted = `(?:"([^"\n]*)"|'([^'\n]*)'|` + "`([^`]*)`)"
+
+type extractor struct {
+	kind string
+	re   *regexp.Regexp
+	//Index of the submatch holding the method, 0 if there is none
+	methodGroup int
+}
+
+// The more specific extractors come first, the same value found by the generic path extractor later is ignored
+var extractors = []extractor{
+	{kind: "fetch", re: regexp.MustCompile(`\bfetch\(\s*` + quoted)},
+	{kind: "axios", re: regexp.MustCompile(`\baxios(?:\.(get|post|put|patch|delete|head|options|request))?\(\s*` + quoted), methodGroup: 1},
+	{kind: "jquery", re: regexp.MustCompile(`(?:\$|\bjQuery)\.(get|post|ajax|getJSON)\(\s*` + quoted), methodGroup: 1},
+	{kind: "xhr", re: regexp.MustCompile(`\.open\(\s*["'](GET|POST|PUT|PATCH|DELETE|HEAD|OPTIONS|get|post|put|patch|delete|head|options)["']\s*,\s*` + quoted), methodGroup: 1},
+	{kind: "route", re: regexp.MustCompile(`\b(?:path|route|url)\s*:\s*` + quoted)},
+	{kind: "path", re: regexp.MustCompile(quoted)},
+}
+
+var graphqlRegex = regexp.MustCompile(`\b(query|mutation|subscription)\s+([A-Za-z_][A-Za-z0-9_]*)\s*[({]`)
+
+// A value looks like an endpoint if it is an absolute url or an absolute or relative path
+var endpointRegex = regexp.MustCompile(`^(?:(?:https?:)?//[\w.\-]+(?::\d+)?(?:/[^\s<>]*)?|\.{0,2}/[\w\-.~%!$&'()*+,;=:@/{}]*[\w}/](?:\?[^\s<>]*)?)$`)
+
+// Extract returns the endpoints found in a javascript file, every value is returned once per kind
+func Extract(body string) []Endpoint {
+	endpoints := []Endpoint{}
+	seen := map[string]bool{}
+
+	for _, e := range extractors {
+		for _, m := range e.re.FindAllStringSubmatchIndex(body, -1) {
+			start, end := valueIndex(m)
+			if start < 0 {
+				continue
+			}
+			value := body[start:end]
+
+			if e.kind == "path" {
+				if seen[value] {
+					continue
+				}
+			} else if seen[e.kind+value] {
+				continue
+			}
+			if !isEndpoint(value) {
+				continue
+			}
+			seen[value] = true
+			seen[e.kind+value] = true
+
+			method := ""
+			if e.methodGroup != 0 && m[2*e.methodGroup] >= 0 {
+				method = httpMethod(body[m[2*e.methodGroup]:m[2*e.methodGroup+1]])
+			}
+			endpoints = append(endpoints, Endpoint{Value: value, Kind: e.kind, Method: method, Offset: start})
+		}
+	}
+
+	for _, m := range graphqlRegex.FindAllStringSubmatchIndex(body, -1) {
+		value := body[m[2]:m[3]] + " " + body[m[4]:m[5]]
+		if seen["graphql"+value] {
+			continue
+		}
+		seen["graphql"+value] = true
+		endpoints = append(endpoints, Endpoint{Value: value, Kind: "graphql", Offset: m[0]})
+	}
+
+	return endpoints
+}
+
+// valueIndex returns the start and end of the quoted value, the last three submatches are the three quote styles
+func valueIndex(m []int) (int, int) {
+	for i := len(m) - 6; i < len(m); i += 2 {
+		if m[i] >= 0 {
+			return m[i], m[i+1]
+		}
+	}
+	return -1, -1
+}
+
+// httpMethod maps the called function to the http method, e.g. getJSON is a GET. Empty is returned if the method
+// is decided by an options argument.
+func httpMethod(call string) string {
+	switch call = strings.ToUpper(call); call {
+	case "GETJSON":
+		return "GET"
+	case "AJAX", "REQUEST":
+		return ""
+	default:
+		return call
+	}
+}
+
+func isEndpoint(value string) bool {
+	if len(value) < 2 || len(value) > 500 {
+		return false
+	}
+	//Comments and regex sources are common false positives
+	if strings.HasPrefix(value, "//") && !strings.Contains(value, ".") {
+		return false
+	}
+	return endpointRegex.MatchString(value)
+}
@@ -0,0 +1,133 @@
+// Package fixture is a small web application with the things the crawler has to deal with, for integration tests
+package fixture
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Pages of the site, every page exercises one thing. %s in a page is replaced with the url of the out of scope site.
+var pages = map[string]string{
+	"/links":        `<a href="/links/target">next</a>`,
+	"/links/target": `<p>target</p>`,
+
+	"/buttons": `<button onclick="fetch('/api/button')">button</button>
+<div style="width:100px;height:30px" onclick="fetch('/api/div')">div</div>
+<span id="listener" style="cursor:pointer;display:inline-block;width:100px;height:30px">listener</span>
+<script>document.getElementById("listener").addEventListener("click", () => fetch("/api/listener"))</script>`,
+
+	"/forms":  `<form action="/search" method="get"><input name="q" value="test"><button type="submit">search</button></form>`,
+	"/search": `<p>results</p>`,
+
+	"/spa": `<button onclick="history.pushState({}, '', '/spa/settings'); fetch('/api/settings')">settings</button>`,
+
+	"/popup":        `<button onclick="window.open('/popup/window')">open</button>`,
+	"/popup/window": `<script>fetch('/api/popup')</script>`,
+
+	"/iframe":         `<iframe src="/iframe/content" width="300" height="100"></iframe>`,
+	"/iframe/content": `<button onclick="fetch('/api/iframe-click')">inside</button><script>fetch('/api/iframe-load')</script>`,
+	//The iframe is out of process as it is cross-origin
+	"/iframe/cross": `<iframe src="%s/outside/frame" width="300" height="100"></iframe>`,
+
+	"/shadow": `<div id="host"></div>
+<script>
+const root = document.getElementById("host").attachShadow({mode: "open"});
+root.innerHTML = '<button>shadow</button>';
+root.querySelector("button").addEventListener("click", () => fetch("/api/shadow"));
+</script>`,
+
+	"/scope": `<a href="%s/outside">outside</a>`,
+
+	"/logout": `<button onclick="fetch('/api/profile')">profile</button>
+<button onclick="location = '/logout/done'">logout</button>`,
+	"/logout/done": `<p>logged out</p>`,
+
+	//The poll never ends, the page only continues if it gets the first chunk
+	"/stream": `<script>fetch('/api/poll').then((r) => r.body.getReader().read()).then(() => fetch('/api/after-poll'))</script>`,
+}
+
+// The out of scope site, crawling must stop when it is reached
+var outsidePages = map[string]string{
+	"/outside":       `<button onclick="fetch('/api/outside')">outside</button>`,
+	"/outside/frame": `<script>window.addEventListener("message", (e) => console.log(e.data))</script>`,
+}
+
+// Site is the fixture site and an out of scope site it links to. The out of scope site is reached through localhost,
+// so the fixture site is in scope with the scope 127.0.0.1 and the out of scope site is not.
+type Site struct {
+	Server  *httptest.Server
+	Outside *httptest.Server
+
+	lock sync.Mutex
+	hits map[string]int
+}
+
+// New starts the sites, Close must be called when done
+func New() *Site {
+	s := &Site{hits: map[string]int{}}
+	s.Outside = httptest.NewServer(s.handler(outsidePages, ""))
+	outsideURL := strings.Replace(s.Outside.URL, "127.0.0.1", "localhost", 1)
+	s.Server = httptest.NewServer(s.handler(pages, outsideURL))
+	return s
+}
+
+func (s *Site) Close() {
+	s.Server.Close()
+	s.Outside.Close()
+}
+
+// URL of a page of the fixture site
+func (s *Site) URL(path string) string {
+	return s.Server.URL + path
+}
+
+// Hits is how many times the path was requested on either of the sites
+func (s *Site) Hits(path string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.hits[path]
+}
+
+func (s *Site) handler(pages map[string]string, outsideURL string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.lock.Lock()
+		s.hits[r.URL.Path]++
+		s.lock.Unlock()
+
+		if r.URL.Path == "/api/poll" {
+			poll(w, r)
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"ok": true}`)
+			return
+		}
+
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if strings.Contains(page, "%s") {
+			page = fmt.Sprintf(page, outsideURL)
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, "<!DOCTYPE html><html><head><title>%s</title></head><body>%s</body></html>", r.URL.Path, page)
+	})
+}
+
+// poll is a chunked long poll, it sends one chunk and keeps the response open until the client is gone
+func poll(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, `{"event": 1}`)
+	w.(http.Flusher).Flush()
+	select {
+	case <-r.Context().Done():
+	case <-time.After(time.Minute):
+	}
+}
@@ -0,0 +1,149 @@
+package frontier
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/AlfredBerg/rod-crawler/internal/scope"
+)
+
+// Target is an url to crawl and how it was found
+type Target struct {
+	Url string
+	//0 for the targets given by the user, +1 for every crawl the url was found through
+	Depth int
+	//Where the url was found, e.g. "input", "dom" or "request"
+	Source string
+}
+
+// Frontier is the deduplicated queue of urls to crawl. Urls found while crawling are only queued when they are in scope,
+// within the max depth and the host hasn't reached its limit. It is safe to use by multiple go routines.
+type Frontier struct {
+	scope []string
+	//The hosts of the seeds, they are the scope if no scope is given
+	seedHosts  []string
+	maxDepth   int
+	maxPerHost int
+
+	lock    sync.Mutex
+	cond    *sync.Cond
+	seen    map[string]bool
+	perHost map[string]int
+	queue   []Target
+	//Targets handed out by Next that are not done yet, they may still add new targets
+	active      int
+	seedsClosed bool
+	stopped     bool
+}
+
+// New creates a frontier. A maxDepth of 0 means only seeds are crawled and a maxPerHost of 0 means no limit.
+// If scope is empty the hosts of the seeds and their subdomains are in scope.
+func New(scope []string, maxDepth, maxPerHost int) *Frontier {
+	f := &Frontier{scope: scope, maxDepth: maxDepth, maxPerHost: maxPerHost, seen: map[string]bool{}, perHost: map[string]int{}}
+	f.cond = sync.NewCond(&f.lock)
+	return f
+}
+
+// Seed queues an url given by the user. Seeds are only deduplicated, not filtered by scope, depth or host limits.
+// Nothing is queued once the frontier is stopped.
+func (f *Frontier) Seed(u string) bool {
+	return f.add(Target{Url: u, Source: "input"}, true)
+}
+
+// Add queues an url found while crawling, it returns true if the url was queued. Nothing is queued once the frontier is stopped.
+func (f *Frontier) Add(t Target) bool {
+	return f.add(t, false)
+}
+
+func (f *Frontier) add(t Target, seed bool) bool {
+	u, err := url.Parse(t.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return false
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment = ""
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	t.Url = u.String()
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.stopped {
+		return false
+	}
+	if seed && !slices.Contains(f.seedHosts, u.Hostname()) {
+		f.seedHosts = append(f.seedHosts, u.Hostname())
+	}
+	if !seed && (t.Depth > f.maxDepth || !f.inScope(u.Hostname())) {
+		return false
+	}
+
+	if f.seen[t.Url] {
+		return false
+	}
+	if !seed && f.maxPerHost != 0 && f.perHost[u.Host] >= f.maxPerHost {
+		return false
+	}
+	f.seen[t.Url] = true
+	f.perHost[u.Host]++
+	f.queue = append(f.queue, t)
+	f.cond.Signal()
+	return true
+}
+
+// inScope checks host against the scope, or the hosts of the seeds if there is no scope. f.lock must be held.
+func (f *Frontier) inScope(host string) bool {
+	if len(f.scope) != 0 {
+		return scope.InScope(host, f.scope)
+	}
+	//Without seeds nothing is in scope, an empty scope would let everything in
+	return len(f.seedHosts) != 0 && scope.InScope(host, f.seedHosts)
+}
+
+// CloseSeeds tells the frontier that no more seeds will be added
+func (f *Frontier) CloseSeeds() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.seedsClosed = true
+	f.cond.Broadcast()
+}
+
+// Stop makes Next return false from now on, even if there are queued targets
+func (f *Frontier) Stop() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.stopped = true
+	f.cond.Broadcast()
+}
+
+// Next blocks until there is a target to crawl. It returns false when the seeds are closed, the queue is empty and
+// no crawl is active that can add more targets, or when the frontier is stopped.
+func (f *Frontier) Next() (Target, bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for len(f.queue) == 0 || f.stopped {
+		if f.stopped || (f.seedsClosed && f.active == 0) {
+			return Target{}, false
+		}
+		f.cond.Wait()
+	}
+
+	t := f.queue[0]
+	f.queue = f.queue[1:]
+	f.active++
+	return t, true
+}
+
+// Done marks a target returned by Next as crawled
+func (f *Frontier) Done() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.active--
+	f.cond.Broadcast()
+}
@@ -0,0 +1,48 @@
+package frontier
+
+import "testing"
+
+func TestAddWithoutScopeOnlyQueuesSeedHosts(t *testing.T) {
+	f := New(nil, 1, 0)
+	f.Seed("https://example.com/")
+
+	tests := []struct {
+		url    string
+		queued bool
+	}{
+		{"https://example.com/page", true},
+		{"https://www.example.com/", true},
+		{"https://cdn.example.net/lib.js", false},
+		{"https://twitter.com/example", false},
+	}
+	for _, tt := range tests {
+		if queued := f.Add(Target{Url: tt.url, Depth: 1}); queued != tt.queued {
+			t.Errorf("Add(%q) = %v, want %v", tt.url, queued, tt.queued)
+		}
+	}
+}
+
+func TestAddWithScope(t *testing.T) {
+	f := New([]string{"example.org"}, 1, 0)
+	f.Seed("https://example.com/")
+
+	if f.Add(Target{Url: "https://example.com/page", Depth: 1}) {
+		t.Error("an url of a seed host outside of the given scope was queued")
+	}
+	if !f.Add(Target{Url: "https://api.example.org/", Depth: 1}) {
+		t.Error("an in scope url was not queued")
+	}
+}
+
+func TestAddAfterStop(t *testing.T) {
+	f := New(nil, 1, 0)
+	f.Seed("https://example.com/")
+	f.Stop()
+
+	if f.Add(Target{Url: "https://example.com/page", Depth: 1}) {
+		t.Error("an url was queued after the frontier was stopped")
+	}
+	if f.Seed("https://example.org/") {
+		t.Error("a seed was queued after the frontier was stopped")
+	}
+}
@@ -110,22 +110,321 @@ var IS_TOP_VISIBLE string = `
 }
 `
 
-var GET_POTENTIAL_PARAMS string = `
+var GET_INPUT_PARAMS string = `
 () => {
-    var str = "";
-    var attack = "foobarbaz"
-    function getallelems(v) {
-        var ii = document.getElementsByTagName(v);
-        for(var i = 0;i < ii.length;i++) {
-            if (!ii[i].name) continue;
-            str += (str?"&":"")+ii[i].name+"="+attack;
+    const params = [];
+    document.querySelectorAll("input[name], textarea[name], select[name], button[name]").forEach(e => {
+        //The parameters of a form belong to where it is submitted, other inputs to the page itself
+        const form = e.form;
+        params.push({
+            action: form && form.action ? form.action : document.location.href,
+            method: form ? form.method : "get",
+            name: e.name,
+            value: e.type === "password" ? "" : String(e.value || ""),
+        });
+    });
+    return params;
+}
+`
+
+var GET_LINKS string = `
+() => {
+    var urls = [];
+    document.querySelectorAll("a[href], area[href]").forEach(e => urls.push(e.href));
+    document.querySelectorAll("form").forEach(e => urls.push(e.action));
+    document.querySelectorAll("iframe[src], frame[src]").forEach(e => urls.push(e.src));
+    return urls.filter(u => typeof u === "string" && (u.startsWith("http://") || u.startsWith("https://")));
+}
+`
+
+// Name of the binding ROUTE_HOOK reports through
+const ROUTE_BINDING = "__rodCrawlerRoute"
+
+// ROUTE_HOOK reports every new document and every client side route change, pushState/replaceState, hash routing and history
+// navigation, so they can be treated as distinct page states
+var ROUTE_HOOK string = `
+(() => {
+    if (window !== window.top) return;
+
+    const report = (kind) => {
+        try {
+            window.__rodCrawlerRoute(JSON.stringify({kind: kind, url: location.href}));
+        } catch (e) {}
+    };
+
+    for (const name of ["pushState", "replaceState"]) {
+        const original = history[name];
+        history[name] = function () {
+            const result = original.apply(this, arguments);
+            report(name);
+            return result;
+        };
+    }
+    window.addEventListener("hashchange", () => report("hashchange"));
+    window.addEventListener("popstate", () => report("popstate"));
+
+    report("document");
+})();
+`
+
+// Name of the binding POSTMESSAGE_HOOK reports through
+const POSTMESSAGE_BINDING = "__rodCrawlerPostMessage"
+
+// POSTMESSAGE_HOOK reports every postMessage sent through the window of a frame, every message received by it and every
+// registered message listener with the stack that registered it. It runs in all frames.
+var POSTMESSAGE_HOOK string = `
+(() => {
+    const binding = window.__rodCrawlerPostMessage;
+    if (typeof binding !== "function") return;
+    const stringify = JSON.stringify;
+
+    const report = (m) => {
+        m.frame = location.href;
+        try {
+            binding(stringify(m));
+        } catch (e) {}
+    };
+
+    // The structure of the data without the values, e.g. {"type": "string", "payload": {"id": "number"}}
+    const shape = (v, depth) => {
+        if (v === null) return "null";
+        if (Array.isArray(v)) return depth > 3 || v.length === 0 ? "array" : [shape(v[0], depth + 1)];
+        if (typeof v === "object") {
+            if (depth > 3) return "object";
+            const s = {};
+            for (const k of Object.keys(v).slice(0, 50)) s[k] = shape(v[k], depth + 1);
+            return s;
+        }
+        return typeof v;
+    };
+    const preview = (v) => {
+        try {
+            const s = typeof v === "string" ? v : stringify(v);
+            return String(s).slice(0, 2000);
+        } catch (e) {
+            return String(v).slice(0, 2000);
+        }
+    };
+    const stack = () => (new Error().stack || "").split("\n").slice(2).join("\n");
+
+    const addEventListener = EventTarget.prototype.addEventListener;
+    addEventListener.call(window, "message", (e) => {
+        report({kind: "received", origin: e.origin, shape: shape(e.data, 0), data: preview(e.data)});
+    }, true);
+
+    EventTarget.prototype.addEventListener = function (type, listener, options) {
+        if (type === "message" && this === window) {
+            report({kind: "listener", listener: String(listener).slice(0, 2000), stack: stack()});
+        }
+        return addEventListener.call(this, type, listener, options);
+    };
+
+    const onmessage = Object.getOwnPropertyDescriptor(window, "onmessage") || Object.getOwnPropertyDescriptor(Window.prototype, "onmessage");
+    if (onmessage && onmessage.set) {
+        Object.defineProperty(window, "onmessage", {
+            configurable: true,
+            get: onmessage.get,
+            set: function (listener) {
+                report({kind: "listener", listener: String(listener).slice(0, 2000), stack: stack()});
+                return onmessage.set.call(this, listener);
+            },
+        });
+    }
+
+    const postMessage = window.postMessage;
+    window.postMessage = function (message, targetOrigin) {
+        const to = typeof targetOrigin === "object" && targetOrigin !== null ? targetOrigin.targetOrigin : targetOrigin;
+        report({kind: "sent", targetOrigin: String(to === undefined ? "/" : to), shape: shape(message, 0), data: preview(message), stack: stack()});
+        return postMessage.apply(this, arguments);
+    };
+})();
+`
+
+// Name of the binding DOM_XSS_HOOK reports through
+const DOM_XSS_BINDING = "__rodCrawlerDomXss"
+
+// DOM_XSS_HOOK is called with a canary and wraps common DOM XSS sinks. A sink hit is reported when the value reaching the sink
+// contains the canary or the value of a source: location, referrer, window.name, storage or received postMessage data.
+// The canary is put in an empty window.name. Pages that read window.name see it, so it is removed again when the page is left
+// to not leak into the next page. Sources are only matched when they are long enough to not match by chance.
+var DOM_XSS_HOOK string = `
+(canary) => {
+    const binding = window.__rodCrawlerDomXss;
+    if (typeof binding !== "function") return;
+    const stringify = JSON.stringify;
+    const minLength = 6;
+
+    try {
+        if (window === window.top && !window.name) {
+            window.name = canary;
+            window.addEventListener("pagehide", () => {
+                if (window.name === canary) window.name = "";
+            }, true);
+        }
+    } catch (e) {}
+
+    const messages = [];
+    let received = 0;
+    window.addEventListener("message", (e) => {
+        try {
+            received++;
+            messages.push(typeof e.data === "string" ? e.data : stringify(e.data));
+            if (messages.length > 20) messages.shift();
+        } catch (e) {}
+    }, true);
+
+    // The sources only change with the page state, so they are cached until it changes
+    let cached = null;
+    let cachedKey = null;
+    const sources = () => {
+        let key;
+        try {
+            key = [location.href, window.name, document.referrer, received, window.localStorage.length, window.sessionStorage.length].join("\n");
+        } catch (e) {
+            key = [location.href, window.name, document.referrer, received].join("\n");
+        }
+        if (key !== cachedKey) {
+            cached = collectSources();
+            cachedKey = key;
+        }
+        return cached;
+    };
+    const collectSources = () => {
+        const s = [];
+        const add = (name, v, length) => {
+            if (typeof v === "string" && v.length >= Math.max(length, minLength)) s.push([name, v]);
+        };
+        const decode = (v) => {
+            try {
+                return decodeURIComponent(v);
+            } catch (e) {
+                return v;
+            }
+        };
+        new URLSearchParams(location.search).forEach((v, k) => add("location.search " + k, v, 4));
+        add("location.hash", decode(location.hash.slice(1)), 4);
+        add("document.referrer", document.referrer, 8);
+        add("window.name", window.name, 4);
+        for (const [name, storage] of [["localStorage", window.localStorage], ["sessionStorage", window.sessionStorage]]) {
+            try {
+                for (let i = 0; i < Math.min(storage.length, 50); i++) {
+                    const key = storage.key(i);
+                    add(name + " " + key, storage.getItem(key), 8);
+                }
+            } catch (e) {}
+        }
+        messages.forEach((m) => add("postMessage", m, 8));
+        return s;
+    };
+
+    const reported = new Set();
+    const check = (sink, value) => {
+        if (typeof value !== "string" || value.length < minLength) return;
+        let source = value.includes(canary) ? "canary" : null;
+        if (!source) {
+            const hit = sources().find(([, v]) => value.includes(v));
+            if (!hit) return;
+            source = hit[0];
+        }
+
+        const stack = (new Error().stack || "").split("\n").slice(3).join("\n");
+        const key = sink + source + stack;
+        if (reported.has(key)) return;
+        reported.add(key);
+        try {
+            binding(stringify({sink: sink, source: source, value: value.slice(0, 2000), canary: value.includes(canary), stack: stack, url: location.href}));
+        } catch (e) {}
+    };
+
+    const wrapSetter = (proto, property, sink) => {
+        const d = Object.getOwnPropertyDescriptor(proto, property);
+        if (!d || !d.set) return;
+        Object.defineProperty(proto, property, {
+            configurable: true,
+            enumerable: d.enumerable,
+            get: d.get,
+            set: function (v) {
+                check(sink, v);
+                return d.set.call(this, v);
+            },
+        });
+    };
+    const wrapMethod = (obj, method, sink, argument) => {
+        const original = obj && obj[method];
+        if (typeof original !== "function") return;
+        obj[method] = function () {
+            check(sink, arguments[argument]);
+            return original.apply(this, arguments);
+        };
+    };
+
+    wrapSetter(Element.prototype, "innerHTML", "innerHTML");
+    wrapSetter(Element.prototype, "outerHTML", "outerHTML");
+    wrapSetter(HTMLIFrameElement.prototype, "srcdoc", "iframe.srcdoc");
+    wrapSetter(HTMLScriptElement.prototype, "src", "script.src");
+    wrapSetter(HTMLScriptElement.prototype, "text", "script.text");
+    wrapMethod(Element.prototype, "insertAdjacentHTML", "insertAdjacentHTML", 1);
+    wrapMethod(Document.prototype, "write", "document.write", 0);
+    wrapMethod(Document.prototype, "writeln", "document.writeln", 0);
+    wrapMethod(Range.prototype, "createContextualFragment", "createContextualFragment", 0);
+
+    const setAttribute = Element.prototype.setAttribute;
+    Element.prototype.setAttribute = function (name, value) {
+        const n = String(name).toLowerCase();
+        if (n.startsWith("on") || n === "href" || n === "src" || n === "srcdoc" || n === "action" || n === "formaction") {
+            check("setAttribute " + n, value);
         }
+        return setAttribute.apply(this, arguments);
+    };
+
+    const originalEval = window.eval;
+    window.eval = function (code) {
+        check("eval", code);
+        return originalEval(code);
+    };
+    const OriginalFunction = window.Function;
+    const WrappedFunction = function () {
+        check("Function", Array.prototype.join.call(arguments, ","));
+        return OriginalFunction.apply(this, arguments);
+    };
+    WrappedFunction.prototype = OriginalFunction.prototype;
+    window.Function = WrappedFunction;
+    for (const name of ["setTimeout", "setInterval"]) {
+        const original = window[name];
+        window[name] = function (handler) {
+            if (typeof handler === "string") check(name, handler);
+            return original.apply(this, arguments);
+        };
     }
 
-    getallelems("input");
-    getallelems("textarea");
-    getallelems("select");
-    str = document.location+(document.location.search.indexOf("?") ==  - 1?"?":"&")+str;
-    return str
+    // Location can't be wrapped, but every location assignment is a navigation
+    if (window.navigation) {
+        window.navigation.addEventListener("navigate", (e) => check("location", e.destination.url));
+    }
+
+    // jQuery is loaded by the page after this runs, so wrap it once it shows up
+    const wrapJQuery = () => {
+        const jq = window.jQuery;
+        if (!jq || !jq.fn || jq.fn.__rodCrawler) return;
+        jq.fn.__rodCrawler = true;
+        for (const method of ["html", "append", "prepend", "after", "before", "replaceWith"]) {
+            wrapMethod(jq.fn, method, "jQuery." + method, 0);
+        }
+    };
+    document.addEventListener("DOMContentLoaded", wrapJQuery);
+    window.addEventListener("load", wrapJQuery);
+    let tries = 0;
+    const interval = setInterval(() => {
+        wrapJQuery();
+        if (++tries > 20) clearInterval(interval);
+    }, 500);
+}
+`
+
+var GET_PARAM_NAMES string = `
+() => {
+    const names = new Set();
+    document.querySelectorAll("input[name], textarea[name], select[name], button[name]").forEach(e => names.add(e.name));
+    return Array.from(names);
 }
 `
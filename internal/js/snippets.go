@@ -0,0 +1,35 @@
+package js
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Snippet is a user provided script evaluated on every page state. The script must be a function expression like the
+// scripts in this package, it may be async and returns {findings: [{title, detail}], urls: [...]} where both are optional.
+type Snippet struct {
+	//The file name without the .js extension
+	Name   string
+	Script string
+}
+
+// LoadSnippets reads the .js files in dir, sorted by name
+func LoadSnippets(dir string) ([]Snippet, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.js"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	snippets := []Snippet{}
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, Snippet{Name: strings.TrimSuffix(filepath.Base(f), ".js"), Script: string(b)})
+	}
+	return snippets, nil
+}
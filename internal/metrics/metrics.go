@@ -0,0 +1,193 @@
+// Package metrics measures how well a target was crawled
+package metrics
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Why the crawl of a target stopped
+const (
+	StopBrowserFailed = "browser-failed"
+	//The tab crashed or the connection to the browser was lost while crawling
+	StopBrowserCrashed   = "browser-crashed"
+	StopNavigationFailed = "navigation-failed"
+	StopOutOfScope       = "out-of-scope"
+	StopNoElements       = "no-elements"
+	StopMaxActions       = "max-actions"
+	StopMaxPageStates    = "max-page-states"
+	StopTimeout          = "timeout"
+	StopCanceled         = "canceled"
+	StopInvalidUrl       = "invalid-url"
+)
+
+// The status of a crawled target
+const (
+	//The target was crawled until a budget was spent or there was nothing more to do
+	StatusDone = "done"
+	//The target could not be crawled, it can be re-queued
+	StatusFailed = "failed"
+	//The crawl was stopped before it was done
+	StatusCanceled = "canceled"
+)
+
+// Result of the crawl of one target
+type Result struct {
+	Target string `json:"target"`
+	Depth  int    `json:"depth"`
+	//Starts at 1, a target is crawled again when the browser was lost
+	Attempt    int    `json:"attempt"`
+	Status     string `json:"status"`
+	StopReason string `json:"stopReason"`
+	Error      string `json:"error,omitempty"`
+	//The url of the last page state, e.g. where a redirect went
+	FinalUrl string `json:"finalUrl"`
+	//Including the retries
+	NavigationAttempts int           `json:"navigationAttempts"`
+	Started            time.Time     `json:"started"`
+	NavigationDuration time.Duration `json:"navigationDuration"`
+	Duration           time.Duration `json:"duration"`
+	Metrics            Metrics       `json:"metrics"`
+}
+
+// Status is the status of a crawl that stopped for reason
+func Status(reason string) string {
+	switch reason {
+	case StopBrowserFailed, StopBrowserCrashed, StopNavigationFailed, StopInvalidUrl:
+		return StatusFailed
+	case StopCanceled:
+		return StatusCanceled
+	default:
+		return StatusDone
+	}
+}
+
+// Metrics of the coverage of the crawl of one target
+type Metrics struct {
+	UniqueUrls int `json:"uniqueUrls"`
+	PageStates int `json:"pageStates"`
+	//Clickable elements found, per page state
+	ElementsDiscovered int `json:"elementsDiscovered"`
+	ElementsClicked    int `json:"elementsClicked"`
+	//Elements that were covered by something else or had no size when they were about to be clicked
+	ElementsInvisible int            `json:"elementsInvisible"`
+	Requests          int            `json:"requests"`
+	RequestsPerHost   map[string]int `json:"requestsPerHost"`
+	//Unique method and path template pairs, e.g. GET /users/{id}
+	Endpoints int `json:"endpoints"`
+}
+
+// Collector collects the metrics of a crawl. It is safe to use by multiple go routines.
+type Collector struct {
+	lock       sync.Mutex
+	urls       map[string]bool
+	states     map[string]bool
+	discovered map[string]bool
+	clicked    map[string]bool
+	invisible  map[string]bool
+	requests   int
+	hosts      map[string]int
+	endpoints  map[string]bool
+	stopReason string
+}
+
+func NewCollector() *Collector {
+	return &Collector{urls: map[string]bool{}, states: map[string]bool{}, discovered: map[string]bool{},
+		clicked: map[string]bool{}, invisible: map[string]bool{}, hosts: map[string]int{}, endpoints: map[string]bool{}}
+}
+
+func (c *Collector) Request(method string, u *url.URL) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.requests++
+	c.urls[u.String()] = true
+	c.hosts[u.Host]++
+	c.endpoints[method+" "+u.Host+PathTemplate(u.EscapedPath())] = true
+}
+
+func (c *Collector) PageState(state string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.states[state] = true
+}
+
+// Discovered records a clickable element, element identifies it within its page state
+func (c *Collector) Discovered(element string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.discovered[element] = true
+}
+
+func (c *Collector) Clicked(element string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.clicked[element] = true
+}
+
+func (c *Collector) Invisible(element string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.invisible[element] = true
+}
+
+// Stop records why the crawl stopped, only the first reason is kept
+func (c *Collector) Stop(reason string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.stopReason == "" {
+		c.stopReason = reason
+	}
+}
+
+func (c *Collector) Metrics() Metrics {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	hosts := map[string]int{}
+	for h, n := range c.hosts {
+		hosts[h] = n
+	}
+	return Metrics{
+		UniqueUrls:         len(c.urls),
+		PageStates:         len(c.states),
+		ElementsDiscovered: len(c.discovered),
+		ElementsClicked:    len(c.clicked),
+		ElementsInvisible:  len(c.invisible),
+		Requests:           c.requests,
+		RequestsPerHost:    hosts,
+		Endpoints:          len(c.endpoints),
+	}
+}
+
+// StopReason is the first reason given to Stop
+func (c *Collector) StopReason() string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.stopReason
+}
+
+var (
+	numberRegex = regexp.MustCompile(`^\d+$`)
+	uuidRegex   = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	//Hashes and object ids, long enough to not be words
+	hexRegex = regexp.MustCompile(`^[0-9a-fA-F]{16,}$`)
+)
+
+// PathTemplate replaces the path segments that look like ids with placeholders, e.g. /users/123/posts becomes /users/{id}/posts
+func PathTemplate(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		switch {
+		case numberRegex.MatchString(s):
+			segments[i] = "{id}"
+		case uuidRegex.MatchString(s):
+			segments[i] = "{uuid}"
+		case hexRegex.MatchString(s):
+			segments[i] = "{hash}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
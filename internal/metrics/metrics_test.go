@@ -0,0 +1,35 @@
+package metrics
+
+import "testing"
+
+func TestPathTemplate(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/", "/"},
+		{"/users", "/users"},
+		{"/users/123", "/users/{id}"},
+		{"/users/123/posts/7", "/users/{id}/posts/{id}"},
+		{"/orders/1b4e28ba-2fa1-11d2-883f-0016d3cca427", "/orders/{uuid}"},
+		{"/assets/5d41402abc4b2a76b9719d911017c592/app.js", "/assets/{hash}/app.js"},
+		//Too short to be a hash
+		{"/colors/ffffff", "/colors/ffffff"},
+		{"/v2/api", "/v2/api"},
+	}
+	for _, tt := range tests {
+		if got := PathTemplate(tt.path); got != tt.want {
+			t.Errorf("PathTemplate(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestStopKeepsFirstReason(t *testing.T) {
+	c := NewCollector()
+	c.Stop(StopNoElements)
+	c.Stop(StopMaxActions)
+
+	if got := c.StopReason(); got != StopNoElements {
+		t.Errorf("stop reason is %q, want %q", got, StopNoElements)
+	}
+}
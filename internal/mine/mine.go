@@ -0,0 +1,251 @@
+package mine
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Never read more than this from a response
+const maxBodySize = 10 * 1024 * 1024
+
+// Common names of hidden parameters, used when no wordlist is given
+var DefaultWordlist = []string{
+	"id", "q", "query", "search", "s", "page", "limit", "offset", "sort", "order", "filter", "format", "lang", "locale",
+	"debug", "test", "admin", "dev", "preview", "draft", "verbose", "trace", "internal", "beta", "feature",
+	"callback", "jsonp", "cb", "redirect", "redirect_uri", "redirect_url", "return", "return_to", "returnUrl", "next", "url",
+	"continue", "dest", "destination", "target", "file", "path", "dir", "template", "view", "include", "load", "action",
+	"cmd", "exec", "type", "mode", "user", "username", "email", "token", "key", "api_key", "access_token", "auth", "role",
+	"source", "ref", "from", "to", "name", "value", "data", "json", "xml", "config", "settings", "version", "v",
+}
+
+// Identifiers used as parameter names in javascript, e.g. "?page=", searchParams.get("id") or formData.append("name"
+var javascriptNameRegexes = []*regexp.Regexp{
+	regexp.MustCompile(`[?&]([A-Za-z_][\w\-\[\]]{0,39})=`),
+	regexp.MustCompile(`\.(?:get|getAll|has|set|append)\(\s*["']([A-Za-z_][\w\-\[\]]{0,39})["']`),
+	regexp.MustCompile(`\bname\s*[:=]\s*["']([A-Za-z_][\w\-\[\]]{0,39})["']`),
+}
+
+// NamesFromJavascript returns the identifiers a javascript file uses as parameter names
+func NamesFromJavascript(body string) []string {
+	seen := map[string]bool{}
+	names := []string{}
+	for _, re := range javascriptNameRegexes {
+		for _, m := range re.FindAllStringSubmatch(body, -1) {
+			if !seen[m[1]] {
+				seen[m[1]] = true
+				names = append(names, m[1])
+			}
+		}
+	}
+	return names
+}
+
+// Miner finds the parameters an endpoint accepts by sending candidate names in batches and splitting every batch that
+// changes the response until the names that cause the change are found
+type Miner struct {
+	//Headers sent with every request, e.g. the session of the crawl
+	Headers http.Header
+	//How many candidates are sent in one request
+	BatchSize int
+
+	client *http.Client
+}
+
+func New(headers http.Header, batchSize int) *Miner {
+	//Set InsecureSkipVerify as we want to be able to crawl pages with bad certificates
+	tr := &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+	client := &http.Client{
+		Transport: tr,
+		Timeout:   time.Second * 30,
+		//A redirect is a difference in itself, it should not be followed
+		CheckRedirect: func(req *http.Request, via []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	return &Miner{Headers: headers, BatchSize: batchSize, client: client}
+}
+
+// signature is what is compared between the baseline and the responses with candidates
+type signature struct {
+	status   int
+	location string
+	length   int
+	lines    int
+}
+
+// baseline is the response without candidates, and what parts of it are stable between requests
+type baseline struct {
+	signature
+	stableLength bool
+	stableLines  bool
+	//The endpoint reflects the values of any name, e.g. it echoes the whole url, so a reflection says nothing about the names
+	echoes bool
+}
+
+// Mine returns the candidates that change the response of the endpoint u, sent in the query for GET and in a form body otherwise
+func (m *Miner) Mine(method, u string, candidates []string) ([]string, error) {
+	first, _, err := m.send(method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	second, _, err := m.send(method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if first.status != second.status || first.location != second.location {
+		//Nothing can be learned from an endpoint that answers differently every time
+		return nil, nil
+	}
+	b := baseline{signature: first, stableLength: first.length == second.length, stableLines: first.lines == second.lines}
+
+	//A random name is never used by the endpoint
+	value := canary()
+	_, body, err := m.send(method, u, map[string]string{canary(): value})
+	if err != nil {
+		return nil, err
+	}
+	b.echoes = strings.Contains(body, value)
+
+	found := []string{}
+	for start := 0; start < len(candidates); start += m.BatchSize {
+		batch := candidates[start:min(start+m.BatchSize, len(candidates))]
+		accepted, err := m.split(method, u, b, batch)
+		if err != nil {
+			return found, err
+		}
+		found = append(found, accepted...)
+	}
+	return found, nil
+}
+
+// split returns the candidates of the batch that change the response, halving the batch until the single names are found
+func (m *Miner) split(method, u string, b baseline, batch []string) ([]string, error) {
+	canaries := map[string]string{}
+	for _, c := range batch {
+		canaries[c] = canary()
+	}
+
+	s, body, err := m.send(method, u, canaries)
+	if err != nil {
+		return nil, err
+	}
+
+	//A reflected value tells exactly which name is used, the rest are sent again without it as they may change the
+	//response as well. If all of them are reflected the page most likely echoes the whole url, which says nothing about the names.
+	reflected := []string{}
+	rest := []string{}
+	for _, name := range batch {
+		if strings.Contains(body, canaries[name]) {
+			reflected = append(reflected, name)
+		} else {
+			rest = append(rest, name)
+		}
+	}
+	echoed := b.echoes || (len(batch) > 1 && len(rest) == 0)
+	if len(reflected) != 0 && !echoed {
+		if len(rest) == 0 {
+			return reflected, nil
+		}
+		others, err := m.split(method, u, b, rest)
+		return append(reflected, others...), err
+	}
+
+	if !b.differs(s, echoed) {
+		return nil, nil
+	}
+	if len(batch) == 1 {
+		return batch, nil
+	}
+
+	half := len(batch) / 2
+	left, err := m.split(method, u, b, batch[:half])
+	if err != nil {
+		return nil, err
+	}
+	right, err := m.split(method, u, b, batch[half:])
+	if err != nil {
+		return nil, err
+	}
+	return append(left, right...), nil
+}
+
+func (b baseline) differs(s signature, echoed bool) bool {
+	if s.status != b.status || s.location != b.location {
+		return true
+	}
+	if b.stableLines && s.lines != b.lines {
+		return true
+	}
+	//The echoed values change the length
+	return b.stableLength && !echoed && s.length != b.length
+}
+
+func (m *Miner) send(method, u string, canaries map[string]string) (signature, string, error) {
+	values := url.Values{}
+	for name, value := range canaries {
+		values.Set(name, value)
+	}
+
+	var body io.Reader
+	if method == http.MethodGet {
+		if len(values) != 0 {
+			parsed, err := url.Parse(u)
+			if err != nil {
+				return signature{}, "", err
+			}
+			if parsed.RawQuery == "" {
+				parsed.RawQuery = values.Encode()
+			} else {
+				parsed.RawQuery += "&" + values.Encode()
+			}
+			u = parsed.String()
+		}
+	} else {
+		body = strings.NewReader(values.Encode())
+	}
+
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return signature{}, "", err
+	}
+	for name, vs := range m.Headers {
+		for _, v := range vs {
+			req.Header.Add(name, v)
+		}
+	}
+	if method != http.MethodGet {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	res, err := m.client.Do(req)
+	if err != nil {
+		return signature{}, "", err
+	}
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(res.Body, maxBodySize))
+	if err != nil {
+		return signature{}, "", err
+	}
+	//Redirects often keep the query, only where they go is compared
+	location, _, _ := strings.Cut(res.Header.Get("Location"), "?")
+	s := signature{status: res.StatusCode, location: location, length: len(b), lines: strings.Count(string(b), "\n")}
+	return s, string(b), nil
+}
+
+const canaryChars = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+func canary() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	for i := range b {
+		b[i] = canaryChars[int(b[i])%len(canaryChars)]
+	}
+	return "rm" + string(b)
+}
@@ -0,0 +1,85 @@
+package mine
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+var testCandidates = []string{"a", "b", "c", "q", "d", "e", "admin", "f", "g", "debug", "h"}
+
+func TestMine(t *testing.T) {
+	mux := http.NewServeMux()
+	//Reflects the value of q
+	mux.HandleFunc("/search", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "<p>results for %s</p>", r.URL.Query().Get("q"))
+	})
+	//Echoes the whole query, admin changes the status
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("admin") {
+			w.WriteHeader(http.StatusForbidden)
+		}
+		fmt.Fprintf(w, "<p>%s</p>", r.URL.RawQuery)
+	})
+	//debug adds to the page without reflecting its value
+	mux.HandleFunc("/debug", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<p>page</p>")
+		if r.URL.Query().Has("debug") {
+			fmt.Fprint(w, "<pre>debug info</pre>")
+		}
+	})
+	//Form bodies are mined for other methods
+	mux.HandleFunc("/form", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("e") != "" {
+			fmt.Fprint(w, "<p>e was given</p>")
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		method string
+		path   string
+		found  []string
+	}{
+		{http.MethodGet, "/search", []string{"q"}},
+		{http.MethodGet, "/echo", []string{"admin"}},
+		{http.MethodGet, "/debug", []string{"debug"}},
+		{http.MethodPost, "/form", []string{"e"}},
+		{http.MethodGet, "/none", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			found, err := New(http.Header{}, 4).Mine(tt.method, server.URL+tt.path, testCandidates)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(found, tt.found) {
+				t.Errorf("found %v, want %v", found, tt.found)
+			}
+		})
+	}
+}
+
+func TestSplitFindsEveryChangingName(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, name := range []string{"b", "g"} {
+			if r.URL.Query().Has(name) {
+				fmt.Fprintf(w, "<p>%s</p>\n", name)
+			}
+		}
+	}))
+	defer server.Close()
+
+	m := New(http.Header{}, 100)
+	b := baseline{signature: signature{status: http.StatusOK}, stableLength: true, stableLines: true}
+	found, err := m.split(http.MethodGet, server.URL, b, testCandidates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(found, []string{"b", "g"}) {
+		t.Errorf("found %v, want [b g]", found)
+	}
+}
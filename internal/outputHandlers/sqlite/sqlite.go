@@ -3,9 +3,13 @@ package sqlite
 import (
 	"database/sql"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
 	"sync"
+	"time"
 
+	"github.com/AlfredBerg/rod-crawler/internal/metrics"
+	"github.com/AlfredBerg/rod-crawler/internal/params"
 	_ "github.com/mattn/go-sqlite3"
 	"go.uber.org/zap"
 )
@@ -13,80 +17,90 @@ import (
 type SqliteOutput struct {
 	Database string
 	db       *sql.DB
-	reqChan  chan string
-	resChan  chan string
+	writes   chan write
 	wg       sync.WaitGroup
+}
 
-	dbLock sync.Mutex
+// write is a row to insert, all inserts go through one go routine as the sqlite driver does not allow concurrent writes
+type write struct {
+	insert string
+	args   []any
 }
 
-func (o *SqliteOutput) Init() {
+const requestsTransactionIndex = "CREATE INDEX IF NOT EXISTS requests_transaction_id ON requests(json_extract(request, '$.transactionId'));"
+
+var tables = []string{
+	"CREATE TABLE IF NOT EXISTS requests (id integer not null primary key, request text);",
+	"CREATE TABLE IF NOT EXISTS responses (id integer not null primary key, response text);",
+	//Responses are joined with their request on the transaction id
+	requestsTransactionIndex,
+	"CREATE TABLE IF NOT EXISTS seeds (id integer not null primary key, seed text);",
+	"CREATE TABLE IF NOT EXISTS endpoints (id integer not null primary key, endpoint text);",
+	"CREATE TABLE IF NOT EXISTS sourcemaps (id integer not null primary key, sourcemap text);",
+	"CREATE TABLE IF NOT EXISTS routes (id integer not null primary key, route text);",
+	"CREATE TABLE IF NOT EXISTS websockets (id integer not null primary key, websocket text);",
+	"CREATE TABLE IF NOT EXISTS eventsources (id integer not null primary key, message text);",
+	"CREATE TABLE IF NOT EXISTS postmessages (id integer not null primary key, postmessage text);",
+	"CREATE TABLE IF NOT EXISTS findings (id integer not null primary key, finding text);",
+	"CREATE TABLE IF NOT EXISTS reflections (id integer not null primary key, reflection text);",
+	"CREATE TABLE IF NOT EXISTS targets (id integer not null primary key, target text);",
+	//One row per parameter, it is replaced when the parameter gets new sample values
+	"CREATE TABLE IF NOT EXISTS parameters (id integer not null primary key, key text not null unique, parameter text);",
+}
+
+func (o *SqliteOutput) Init() error {
 	if o.Database == "" {
-		log.Panic("sqlite database file not set")
+		return errors.New("sqlite database file not set")
 	}
 
 	db, err := sql.Open("sqlite3", o.Database)
 	if err != nil {
-		log.Panic(err)
+		return err
 	}
 	o.db = db
 
-	createReq := "CREATE TABLE IF NOT EXISTS requests (id integer not null primary key, request text);"
-
-	_, err = db.Exec(createReq)
-	if err != nil {
-		log.Panicf("failed to create table %q: %s\n", err, createReq)
-		return
+	for _, create := range tables {
+		_, err = db.Exec(create)
+		if err != nil {
+			db.Close()
+			return fmt.Errorf("failed to create table %q: %w", create, err)
+		}
 	}
 
-	o.dbLock = sync.Mutex{}
 	//Buffered channel as the requests/responses can come in bursts
-	o.reqChan = make(chan string, 20)
+	o.writes = make(chan write, 100)
 	o.wg = sync.WaitGroup{}
 	o.wg.Add(1)
 	go func() {
-		insertReq := "INSERT into requests(request) values(?);"
-		for r := range o.reqChan {
-			o.dbLock.Lock()
-			_, err = db.Exec(insertReq, r)
-			o.dbLock.Unlock()
+		for w := range o.writes {
+			_, err := db.Exec(w.insert, w.args...)
 			if err != nil {
-				zap.L().Error("failed to insert request", zap.Error(err), zap.String("insert", insertReq))
-				return
-			}
-		}
-		o.wg.Done()
-	}()
-
-	o.resChan = make(chan string, 20)
-	createRes := "CREATE TABLE IF NOT EXISTS responses (id integer not null primary key, response text);"
-	_, err = db.Exec(createRes)
-	if err != nil {
-		log.Panicf("failed to create table %q: %s\n", err, createRes)
-		return
-	}
-	o.wg.Add(1)
-	go func() {
-		insertRes := "INSERT into responses(response) values(?);"
-		for r := range o.resChan {
-			o.dbLock.Lock()
-			_, err = db.Exec(insertRes, r)
-			o.dbLock.Unlock()
-			if err != nil {
-				zap.L().Error("failed to insert response", zap.Error(err), zap.String("insert", insertRes))
-				return
+				zap.L().Error("failed to insert", zap.Error(err), zap.String("insert", w.insert))
 			}
 		}
 		o.wg.Done()
 	}()
+	return nil
 }
 
 func (o *SqliteOutput) Cleanup() {
-	close(o.reqChan)
+	close(o.writes)
 	o.wg.Wait()
 	o.db.Close()
 }
 
+// insert marshals v to json and queues it to be inserted with the insert statement
+func (o *SqliteOutput) insert(insert string, v any) error {
+	j, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	o.writes <- write{insert: insert, args: []any{string(j)}}
+
+	return nil
+}
+
 type request struct {
 	TransactionIdentifier string              `json:"transactionId"` //The coresponding response and request will have the same uuid
 	Origin                string              `json:"origin"`
@@ -107,27 +121,358 @@ type response struct {
 	StatusLine            string              `json:"status_line"`
 }
 
+type seed struct {
+	Url    string `json:"url"`
+	Source string `json:"source"` //Where the url was found, e.g. robots.txt or sitemap.xml
+	Origin string `json:"origin"` //The target the url was seeded for
+}
+
+type endpoint struct {
+	Source   string `json:"source"` //The url of the javascript file
+	Offset   int    `json:"offset"` //Byte offset of the endpoint in the javascript file
+	Kind     string `json:"kind"`   //How it was found, e.g. fetch, axios, xhr, graphql, route or path
+	Method   string `json:"method"`
+	Endpoint string `json:"endpoint"`
+}
+
+type sourceMap struct {
+	Script    string `json:"script"`
+	Url       string `json:"url"`
+	SourceMap string `json:"sourcemap"`
+}
+
+type route struct {
+	Target string `json:"target"`
+	Url    string `json:"url"`
+	Kind   string `json:"kind"` //How the route was reached, document for a new document or e.g. pushState or hashchange
+}
+
+type webSocket struct {
+	RequestIdentifier string              `json:"requestId"` //All events of the same websocket have the same id
+	Url               string              `json:"url"`
+	Origin            string              `json:"origin"`
+	Event             string              `json:"event"`     //created, handshake_request, handshake_response, frame or closed
+	Direction         string              `json:"direction"` //sent or received
+	Opcode            int                 `json:"opcode"`    //1 for text frames, 2 for binary frames where the payload is base64 encoded
+	Payload           string              `json:"payload"`
+	Headers           map[string][]string `json:"headers"`
+	Timestamp         int64               `json:"timestamp"` //Unix time in milliseconds
+}
+
+type eventSourceMessage struct {
+	RequestIdentifier string `json:"requestId"` //All messages of the same event source have the same id
+	Url               string `json:"url"`
+	Origin            string `json:"origin"`
+	Event             string `json:"event"`
+	EventIdentifier   string `json:"eventId"`
+	Data              string `json:"data"`
+	Timestamp         int64  `json:"timestamp"` //Unix time in milliseconds
+}
+
+type postMessage struct {
+	Origin        string          `json:"origin"`        //The url of the page
+	Frame         string          `json:"frame"`         //The url of the frame that sent or received the message, or registered the listener
+	Kind          string          `json:"kind"`          //sent, received or listener
+	MessageOrigin string          `json:"messageOrigin"` //The origin of the sender of a received message
+	TargetOrigin  string          `json:"targetOrigin"`  //The target origin a message was sent to, * is interesting
+	Shape         json.RawMessage `json:"shape"`         //The structure of the data without the values
+	Data          string          `json:"data"`
+	Listener      string          `json:"listener"` //The source of a registered listener
+	Stack         string          `json:"stack"`
+}
+
+type finding struct {
+	Type      string          `json:"type"` //What found it, e.g. dom-xss
+	Origin    string          `json:"origin"`
+	Title     string          `json:"title"`
+	Detail    json.RawMessage `json:"detail"`
+	Timestamp int64           `json:"timestamp"` //Unix time in milliseconds
+}
+
+type reflection struct {
+	Origin   string `json:"origin"` //The page the parameters were found on
+	Url      string `json:"url"`
+	Method   string `json:"method"`
+	Param    string `json:"param"`
+	Canary   string `json:"canary"`
+	Context  string `json:"context"`  //html, attribute, url, script or comment
+	Location string `json:"location"` //response for the http response, dom for the rendered dom
+}
+
 // The go sqlite driver does not allow for concurrent writes, so there must only be one "SqliteOutput" object used, but HandleRequest is safe to use by multipe go routines
 func (o *SqliteOutput) HandleRequest(transactionIdentifier, origin, method, body, url, path, raw, host string, headers map[string][]string) error {
 	r := request{TransactionIdentifier: transactionIdentifier, Origin: origin, Method: method, Body: body, Url: url, Path: path, Raw: raw, Host: host, Headers: headers}
-	rjson, err := json.Marshal(r)
+	return o.insert("INSERT into requests(request) values(?);", r)
+}
+
+func (o *SqliteOutput) HandleResponse(transactionIdentifier, body, statusLine string, statusCode int, headers map[string][]string) error {
+	r := response{TransactionIdentifier: transactionIdentifier, Body: body, StatusCode: statusCode, StatusLine: statusLine, Headers: headers}
+	return o.insert("INSERT into responses(response) values(?);", r)
+}
+
+func (o *SqliteOutput) HandleSeed(url, source, origin string) error {
+	s := seed{Url: url, Source: source, Origin: origin}
+	return o.insert("INSERT into seeds(seed) values(?);", s)
+}
+
+func (o *SqliteOutput) HandleEndpoint(source, kind, method, value string, offset int) error {
+	e := endpoint{Source: source, Offset: offset, Kind: kind, Method: method, Endpoint: value}
+	return o.insert("INSERT into endpoints(endpoint) values(?);", e)
+}
+
+func (o *SqliteOutput) HandleSourceMap(script, url, content string) error {
+	s := sourceMap{Script: script, Url: url, SourceMap: content}
+	return o.insert("INSERT into sourcemaps(sourcemap) values(?);", s)
+}
+
+func (o *SqliteOutput) HandleRoute(target, url, kind string) error {
+	r := route{Target: target, Url: url, Kind: kind}
+	return o.insert("INSERT into routes(route) values(?);", r)
+}
+
+func (o *SqliteOutput) HandleWebSocket(requestIdentifier, url, origin, event, direction string, opcode int, payload string, headers map[string][]string,
+	timestamp time.Time) error {
+	w := webSocket{RequestIdentifier: requestIdentifier, Url: url, Origin: origin, Event: event, Direction: direction, Opcode: opcode, Payload: payload,
+		Headers: headers, Timestamp: timestamp.UnixMilli()}
+	return o.insert("INSERT into websockets(websocket) values(?);", w)
+}
+
+func (o *SqliteOutput) HandleEventSourceMessage(requestIdentifier, url, origin, event, eventIdentifier, data string, timestamp time.Time) error {
+	m := eventSourceMessage{RequestIdentifier: requestIdentifier, Url: url, Origin: origin, Event: event, EventIdentifier: eventIdentifier, Data: data,
+		Timestamp: timestamp.UnixMilli()}
+	return o.insert("INSERT into eventsources(message) values(?);", m)
+}
+
+func (o *SqliteOutput) HandlePostMessage(origin, frame, kind, messageOrigin, targetOrigin, shape, data, listener, stack string) error {
+	p := postMessage{Origin: origin, Frame: frame, Kind: kind, MessageOrigin: messageOrigin, TargetOrigin: targetOrigin, Data: data, Listener: listener, Stack: stack}
+	if shape != "" {
+		p.Shape = json.RawMessage(shape)
+	}
+	return o.insert("INSERT into postmessages(postmessage) values(?);", p)
+}
+
+// HandleFinding saves something found while crawling, detail must be json
+func (o *SqliteOutput) HandleFinding(findingType, origin, title, detail string) error {
+	f := finding{Type: findingType, Origin: origin, Title: title, Detail: json.RawMessage(detail), Timestamp: time.Now().UnixMilli()}
+	if !json.Valid(f.Detail) {
+		f.Detail, _ = json.Marshal(detail)
+	}
+	return o.insert("INSERT into findings(finding) values(?);", f)
+}
+
+func (o *SqliteOutput) HandleReflection(origin, url, method, param, canary, context, location string) error {
+	r := reflection{Origin: origin, Url: url, Method: method, Param: param, Canary: canary, Context: context, Location: location}
+	return o.insert("INSERT into reflections(reflection) values(?);", r)
+}
+
+// HandleResult saves how the crawl of a target went and its coverage metrics
+func (o *SqliteOutput) HandleResult(r metrics.Result) error {
+	return o.insert("INSERT into targets(target) values(?);", r)
+}
+
+// HandleParameter saves a parameter of the inventory, a parameter saved before with the same key is replaced
+func (o *SqliteOutput) HandleParameter(p params.Parameter) error {
+	j, err := json.Marshal(p)
 	if err != nil {
 		return err
 	}
 
-	o.reqChan <- string(rjson)
+	o.writes <- write{
+		insert: "INSERT into parameters(key, parameter) values(?, ?) ON CONFLICT(key) DO UPDATE SET parameter = excluded.parameter;",
+		args:   []any{p.Key(), string(j)},
+	}
 
 	return nil
 }
 
-func (o *SqliteOutput) HandleResponse(transactionIdentifier, body, statusLine string, statusCode int, headers map[string][]string) error {
-	r := response{TransactionIdentifier: transactionIdentifier, Body: body, StatusCode: statusCode, StatusLine: statusLine, Headers: headers}
-	rjson, err := json.Marshal(r)
+// ReadSourceMaps calls fn with every source map saved in the database
+func ReadSourceMaps(database string, fn func(script, url, content string) error) error {
+	db, err := sql.Open("sqlite3", database)
 	if err != nil {
 		return err
 	}
+	defer db.Close()
 
-	o.resChan <- string(rjson)
+	rows, err := db.Query("SELECT sourcemap FROM sourcemaps;")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
 
-	return nil
+	for rows.Next() {
+		var raw string
+		err = rows.Scan(&raw)
+		if err != nil {
+			return err
+		}
+		var s sourceMap
+		err = json.Unmarshal([]byte(raw), &s)
+		if err != nil {
+			return err
+		}
+		err = fn(s.Script, s.Url, s.SourceMap)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ReadParameters calls fn with every parameter saved in the database
+func ReadParameters(database string, fn func(p params.Parameter) error) error {
+	db, err := sql.Open("sqlite3", database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT parameter FROM parameters ORDER BY id;")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var raw string
+		err = rows.Scan(&raw)
+		if err != nil {
+			return err
+		}
+		var p params.Parameter
+		err = json.Unmarshal([]byte(raw), &p)
+		if err != nil {
+			return err
+		}
+		err = fn(p)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ErrNoTable is returned when reading a table the database does not have, e.g. as it was written by an older version
+var ErrNoTable = errors.New("no such table")
+
+// hasTable checks if the database has the table, sqlite only returns a generic error when querying a missing table
+func hasTable(db *sql.DB, name string) (bool, error) {
+	var n int
+	err := db.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?;", name).Scan(&n)
+	return n != 0, err
+}
+
+// ReadResults calls fn with the result of every crawled target, in the order they were saved. ErrNoTable is returned
+// if the database was written before results were saved.
+func ReadResults(database string, fn func(r metrics.Result) error) error {
+	db, err := sql.Open("sqlite3", database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ok, err := hasTable(db, "targets")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: targets", ErrNoTable)
+	}
+
+	rows, err := db.Query("SELECT target FROM targets ORDER BY id;")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var raw string
+		err = rows.Scan(&raw)
+		if err != nil {
+			return err
+		}
+		var r metrics.Result
+		err = json.Unmarshal([]byte(raw), &r)
+		if err != nil {
+			return err
+		}
+		err = fn(r)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ReadRequests calls fn with the url, method and headers of every request saved in the database, in the order they were made
+func ReadRequests(database string, fn func(url, method string, headers map[string][]string) error) error {
+	db, err := sql.Open("sqlite3", database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	//Parameter extraction urls from older databases have no transaction id, they were never sent
+	rows, err := db.Query("SELECT request FROM requests WHERE json_extract(request, '$.transactionId') != '' ORDER BY id;")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var raw string
+		err = rows.Scan(&raw)
+		if err != nil {
+			return err
+		}
+		var r request
+		err = json.Unmarshal([]byte(raw), &r)
+		if err != nil {
+			return err
+		}
+		err = fn(r.Url, r.Method, r.Headers)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ReadResponses calls fn with the url of the request, the headers and the body of every response saved in the database
+func ReadResponses(database string, fn func(url string, headers map[string][]string, body string) error) error {
+	db, err := sql.Open("sqlite3", database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	//Databases written by older versions don't have the index, without it the join is quadratic
+	_, err = db.Exec(requestsTransactionIndex)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Query(`SELECT json_extract(requests.request, '$.url'), responses.response FROM responses
+		JOIN requests ON json_extract(requests.request, '$.transactionId') = json_extract(responses.response, '$.transactionId');`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var u, raw string
+		err = rows.Scan(&u, &raw)
+		if err != nil {
+			return err
+		}
+		var r response
+		err = json.Unmarshal([]byte(raw), &r)
+		if err != nil {
+			return err
+		}
+		err = fn(u, r.Headers, r.Body)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
 }
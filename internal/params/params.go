@@ -0,0 +1,226 @@
+package params
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Parameter is a parameter name seen for an endpoint, the same name in the same location is only recorded once per host and path
+type Parameter struct {
+	Host     string `json:"host"`
+	Path     string `json:"path"`
+	Location string `json:"location"` //query, body, json, multipart, cookie or header
+	Name     string `json:"name"`
+	//Where it was first seen, e.g. request, form or cookies
+	Source string `json:"source"`
+	//The page state it was first seen on
+	Origin    string   `json:"origin"`
+	Samples   []string `json:"samples"`
+	FirstSeen int64    `json:"firstSeen"` //Unix time in milliseconds
+}
+
+// Key identifies the parameter in the inventory
+func (p Parameter) Key() string {
+	return p.Host + " " + p.Path + " " + p.Location + " " + p.Name
+}
+
+// Found is a parameter with its value as it was seen in a request or a page
+type Found struct {
+	Location string
+	Name     string
+	Value    string
+}
+
+const (
+	maxSamples      = 5
+	maxSampleLength = 200
+	//Large json bodies are cut off at this many parameters
+	maxJsonParams = 200
+)
+
+// Inventory collects the parameters of all endpoints. It is safe to use by multiple go routines.
+type Inventory struct {
+	lock   sync.Mutex
+	params map[string]*Parameter
+}
+
+func NewInventory() *Inventory {
+	return &Inventory{params: map[string]*Parameter{}}
+}
+
+// Add records the parameters found for the endpoint u, it returns the parameters that are new or got a new sample value
+func (i *Inventory) Add(u *url.URL, source, origin string, found []Found) []Parameter {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	changed := []Parameter{}
+	for _, f := range found {
+		p := Parameter{Host: u.Host, Path: path, Location: f.Location, Name: f.Name}
+		existing, ok := i.params[p.Key()]
+		if !ok {
+			p.Source = source
+			p.Origin = origin
+			p.Samples = []string{}
+			p.FirstSeen = time.Now().UnixMilli()
+			existing = &p
+			i.params[p.Key()] = existing
+			existing.addSample(f.Value)
+		} else if !existing.addSample(f.Value) {
+			continue
+		}
+		//A copy so the caller can't race with later samples
+		c := *existing
+		c.Samples = append([]string{}, existing.Samples...)
+		changed = append(changed, c)
+	}
+	return changed
+}
+
+func (p *Parameter) addSample(value string) bool {
+	if value == "" || len(p.Samples) >= maxSamples {
+		return false
+	}
+	if len(value) > maxSampleLength {
+		value = value[:maxSampleLength]
+	}
+	for _, s := range p.Samples {
+		if s == value {
+			return false
+		}
+	}
+	p.Samples = append(p.Samples, value)
+	return true
+}
+
+// FromQuery returns the parameters of the query string
+func FromQuery(u *url.URL) []Found {
+	return fromValues("query", u.Query())
+}
+
+// FromBody returns the parameters of a form, multipart or json request body
+func FromBody(contentType, body string) []Found {
+	if body == "" {
+		return nil
+	}
+	mediaType, mediaParams, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(body)
+		if err != nil {
+			return nil
+		}
+		return fromValues("body", values)
+	case mediaType == "multipart/form-data":
+		form, err := multipart.NewReader(strings.NewReader(body), mediaParams["boundary"]).ReadForm(int64(len(body)))
+		if err != nil {
+			return nil
+		}
+		defer form.RemoveAll()
+		found := fromValues("multipart", form.Value)
+		for name := range form.File {
+			found = append(found, Found{Location: "multipart", Name: name})
+		}
+		return found
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		var v any
+		if json.Unmarshal([]byte(body), &v) != nil {
+			return nil
+		}
+		found := []Found{}
+		flatten(&found, "", v)
+		return found
+	}
+	return nil
+}
+
+// flatten adds the scalar values of the json value v with their path as the name, e.g. user.roles[].name
+func flatten(found *[]Found, name string, v any) {
+	if len(*found) >= maxJsonParams {
+		return
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if name == "" {
+				flatten(found, k, v[k])
+			} else {
+				flatten(found, name+"."+k, v[k])
+			}
+		}
+	case []any:
+		for _, e := range v {
+			flatten(found, name+"[]", e)
+		}
+	case nil:
+		if name != "" {
+			*found = append(*found, Found{Location: "json", Name: name})
+		}
+	default:
+		if name != "" {
+			*found = append(*found, Found{Location: "json", Name: name, Value: fmt.Sprint(v)})
+		}
+	}
+}
+
+// FromCookies returns the cookies of a Cookie request header
+func FromCookies(header string) []Found {
+	r := http.Request{Header: http.Header{"Cookie": {header}}}
+	found := []Found{}
+	for _, c := range r.Cookies() {
+		found = append(found, Found{Location: "cookie", Name: c.Name, Value: c.Value})
+	}
+	return found
+}
+
+// Headers every browser sends, they say nothing about the application
+var standardHeaders = map[string]bool{
+	"accept": true, "accept-encoding": true, "accept-language": true, "cache-control": true, "connection": true, "content-length": true,
+	"content-type": true, "cookie": true, "dnt": true, "host": true, "if-modified-since": true, "if-none-match": true, "origin": true,
+	"pragma": true, "priority": true, "range": true, "referer": true, "te": true, "upgrade-insecure-requests": true, "user-agent": true,
+}
+
+// FromHeaders returns the request headers that are not sent by every browser, e.g. X-Api-Key or Authorization
+func FromHeaders(headers http.Header) []Found {
+	found := []Found{}
+	for name, values := range headers {
+		lower := strings.ToLower(name)
+		if standardHeaders[lower] || strings.HasPrefix(lower, "sec-") {
+			continue
+		}
+		for _, v := range values {
+			found = append(found, Found{Location: "header", Name: lower, Value: v})
+		}
+	}
+	return found
+}
+
+func fromValues(location string, values url.Values) []Found {
+	found := []Found{}
+	for name, vs := range values {
+		if len(vs) == 0 {
+			found = append(found, Found{Location: location, Name: name})
+		}
+		for _, v := range vs {
+			found = append(found, Found{Location: location, Name: name, Value: v})
+		}
+	}
+	return found
+}
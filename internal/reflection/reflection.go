@@ -0,0 +1,119 @@
+package reflection
+
+import (
+	"crypto/rand"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Reflection is a parameter whose canary was found in a response or the rendered dom
+type Reflection struct {
+	Param  string
+	Canary string
+	//Where in the document the canary was found: html, attribute, url, script or comment
+	Context string
+}
+
+const canaryChars = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+// Canaries gives every parameter its own unique canary, so a reflection can be tied to the parameter
+func Canaries(params []string) map[string]string {
+	canaries := map[string]string{}
+	for _, p := range params {
+		b := make([]byte, 8)
+		_, _ = rand.Read(b)
+		for i := range b {
+			b[i] = canaryChars[int(b[i])%len(canaryChars)]
+		}
+		canaries[p] = "rc" + string(b)
+	}
+	return canaries
+}
+
+// Query encodes the parameters with their canaries, sorted by parameter name
+func Query(canaries map[string]string) string {
+	params := []string{}
+	for p := range canaries {
+		params = append(params, p)
+	}
+	sort.Strings(params)
+
+	values := []string{}
+	for _, p := range params {
+		values = append(values, url.QueryEscape(p)+"="+url.QueryEscape(canaries[p]))
+	}
+	return strings.Join(values, "&")
+}
+
+// WithQuery adds the parameters with their canaries to the query of u, the fragment is dropped
+func WithQuery(u string, canaries map[string]string) (string, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return "", err
+	}
+	parsed.Fragment = ""
+	if parsed.RawQuery == "" {
+		parsed.RawQuery = Query(canaries)
+	} else {
+		parsed.RawQuery += "&" + Query(canaries)
+	}
+	return parsed.String(), nil
+}
+
+// Find returns where the canaries are reflected in body, every parameter is returned once per context
+func Find(body string, canaries map[string]string) []Reflection {
+	reflections := []Reflection{}
+	lower := strings.ToLower(body)
+
+	for param, canary := range canaries {
+		seen := map[string]bool{}
+		offset := 0
+		for {
+			i := strings.Index(lower[offset:], canary)
+			if i < 0 {
+				break
+			}
+			c := context(lower, offset+i)
+			if !seen[c] {
+				seen[c] = true
+				reflections = append(reflections, Reflection{Param: param, Canary: canary, Context: c})
+			}
+			offset += i + len(canary)
+		}
+	}
+	return reflections
+}
+
+// Attributes that take an url, a reflection here is an url context
+var urlAttributes = map[string]bool{"href": true, "src": true, "action": true, "formaction": true, "data": true, "srcset": true,
+	"poster": true, "background": true, "cite": true, "ping": true, "xlink:href": true}
+
+var attributeRegex = regexp.MustCompile(`([a-z_:][-a-z0-9_:.]*)\s*=\s*["']?[^"'\s>]*$`)
+
+// context decides where index is in the lower cased html document
+func context(lower string, index int) string {
+	before := lower[:index]
+
+	scriptStart := strings.LastIndex(before, "<script")
+	if scriptStart > strings.LastIndex(before, "</script") {
+		//The canary can still be in an attribute of the script tag itself, the script body may contain < and > anywhere
+		if strings.Contains(before[scriptStart:], ">") {
+			return "script"
+		}
+	}
+	if strings.LastIndex(before, "<!--") > strings.LastIndex(before, "-->") {
+		return "comment"
+	}
+
+	tagStart := strings.LastIndex(before, "<")
+	if tagStart > strings.LastIndex(before, ">") {
+		m := attributeRegex.FindStringSubmatch(before[tagStart:])
+		if m != nil && urlAttributes[m[1]] {
+			return "url"
+		}
+		return "attribute"
+	}
+	return "html"
+}
@@ -0,0 +1,67 @@
+package reflection
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+const canary = "rcabc12345"
+
+func TestContext(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{"html", `<p>CANARY</p>`, "html"},
+		{"after a tag", `<div><p>x</p>CANARY</div>`, "html"},
+		{"attribute", `<input value="CANARY">`, "attribute"},
+		{"unquoted attribute", `<input value=CANARY>`, "attribute"},
+		{"url attribute", `<a href="/search?q=CANARY">`, "url"},
+		{"url attribute after others", `<img alt="x" src='CANARY'>`, "url"},
+		{"script", `<script>var q = "CANARY";</script>`, "script"},
+		{"script with less than", `<script>if (a < b) x = "CANARY";</script>`, "script"},
+		{"script with tags in strings", `<script>el.innerHTML = "<b>" + "CANARY";</script>`, "script"},
+		{"script tag attribute", `<script src="/app.js?v=CANARY"></script>`, "url"},
+		{"script tag other attribute", `<script nonce="CANARY"></script>`, "attribute"},
+		{"after script", `<script>var a = 1;</script><p>CANARY</p>`, "html"},
+		{"comment", `<!-- CANARY -->`, "comment"},
+		{"after comment", `<!-- x --><p>CANARY</p>`, "html"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html := strings.ToLower(strings.Replace(tt.html, "CANARY", canary, 1))
+			if got := context(html, strings.Index(html, canary)); got != tt.want {
+				t.Errorf("context of %s = %q, want %q", tt.html, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFind(t *testing.T) {
+	canaries := map[string]string{"q": "rcqqqqqqqq", "id": "rciiiiiiii", "none": "rcnnnnnnnn"}
+	body := `<html><body>
+<p>Results for RCQQQQQQQQ</p>
+<input name="q" value="rcqqqqqqqq">
+<a href="/item?id=rciiiiiiii">item</a>
+<p>again rcqqqqqqqq</p>
+<script>if (page < 2) load("rciiiiiiii");</script>
+</body></html>`
+
+	found := Find(body, canaries)
+	got := []string{}
+	for _, r := range found {
+		if r.Canary != canaries[r.Param] {
+			t.Errorf("%s has the canary %s", r.Param, r.Canary)
+		}
+		got = append(got, r.Param+" "+r.Context)
+	}
+	sort.Strings(got)
+
+	//Every parameter is found once per context, whatever the case of the reflection
+	want := []string{"id script", "id url", "q attribute", "q html"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("found %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,19 @@
+package scope
+
+import "strings"
+
+// InScope reports if host is one of the scope entries or a subdomain of them. Everything is in scope if scope is empty.
+func InScope(host string, scope []string) bool {
+	if len(scope) == 0 {
+		return true
+	}
+	for _, s := range scope {
+		if host == s {
+			return true
+		}
+		if strings.HasSuffix(host, "."+s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,264 @@
+package seed
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AlfredBerg/rod-crawler/internal/scope"
+	"go.uber.org/zap"
+)
+
+// Well-known files that urls are extracted from, the urls of pages found here are crawled as well
+var wellKnownFiles = []string{
+	"/.well-known/security.txt",
+	"/security.txt",
+	"/.well-known/openid-configuration",
+	"/.well-known/oauth-authorization-server",
+	"/humans.txt",
+}
+
+// Well-known urls that redirect to a page worth crawling
+var wellKnownPages = []string{
+	"/.well-known/change-password",
+}
+
+// Never follow more sitemaps than this for one origin, sitemap indexes can be huge
+const maxSitemaps = 20
+
+// Never read more than this from one file
+const maxBodySize = 10 * 1024 * 1024
+
+var urlRegex = regexp.MustCompile(`https?://[^\s"'<>\\]+`)
+
+// Url is an url found while seeding and the file it was found in
+type Url struct {
+	Url    string
+	Source string
+}
+
+// Seeder fetches robots.txt, sitemaps and well-known files of the origin of the targets. Every origin is only seeded once.
+// It is safe to use by multiple go routines.
+type Seeder struct {
+	//Extra headers sent with every request, e.g. for authentication
+	Headers map[string]string
+	//Sitemaps are only fetched from hosts in scope, without a scope only from the host of the seeded target
+	Scope []string
+	//Used for the logs of the seeding, the global logger is used if nil
+	Logger *zap.Logger
+
+	client *http.Client
+	lock   sync.Mutex
+	seeded map[string]bool
+}
+
+func New(headers map[string]string) *Seeder {
+	//Set InsecureSkipVerify as we want to be able to crawl pages with bad certificates
+	tr := &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+	return &Seeder{Headers: headers, client: &http.Client{Transport: tr, Timeout: time.Second * 10}, seeded: map[string]bool{}}
+}
+
+// log returns the logger of the seeder, nil means the global logger
+func (s *Seeder) log() *zap.Logger {
+	if s.Logger == nil {
+		return zap.L()
+	}
+	return s.Logger
+}
+
+// Seed returns the urls found for the origin of target, nothing is returned if the origin has already been seeded.
+// Seeding stops with what has been found so far when ctx is canceled.
+func (s *Seeder) Seed(ctx context.Context, target string) []Url {
+	t, err := url.Parse(target)
+	if err != nil || t.Host == "" {
+		return nil
+	}
+	origin := t.Scheme + "://" + t.Host
+
+	s.lock.Lock()
+	if s.seeded[origin] {
+		s.lock.Unlock()
+		return nil
+	}
+	s.seeded[origin] = true
+	s.lock.Unlock()
+
+	urls := []Url{}
+
+	robotsUrls, sitemaps := s.robots(ctx, origin)
+	urls = append(urls, robotsUrls...)
+
+	urls = append(urls, s.sitemaps(ctx, append([]string{origin + "/sitemap.xml"}, sitemaps...), t.Hostname())...)
+
+	for _, path := range wellKnownFiles {
+		body, _, err := s.get(ctx, origin+path)
+		//Lots of sites answer every path with their index page, the links in it are not from the file we asked for
+		if err != nil || isHTML(body) {
+			continue
+		}
+		for _, u := range urlRegex.FindAllString(string(body), -1) {
+			urls = append(urls, Url{Url: strings.TrimRight(u, ".,;)"), Source: path})
+		}
+	}
+
+	for _, path := range wellKnownPages {
+		_, finalUrl, err := s.get(ctx, origin+path)
+		//Only a redirect tells us where the page actually is
+		if err != nil || finalUrl == origin+path {
+			continue
+		}
+		urls = append(urls, Url{Url: finalUrl, Source: path})
+	}
+
+	s.log().Info("seeding done", zap.String("origin", origin), zap.Int("urls", len(urls)))
+	return urls
+}
+
+// robots returns the allowed and disallowed paths of robots.txt as urls, and the sitemaps it lists
+func (s *Seeder) robots(ctx context.Context, origin string) (urls []Url, sitemaps []string) {
+	body, _, err := s.get(ctx, origin+"/robots.txt")
+	if err != nil {
+		return nil, nil
+	}
+
+	sc := bufio.NewScanner(bytes.NewReader(body))
+	for sc.Scan() {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		field, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+
+		switch strings.ToLower(strings.TrimSpace(field)) {
+		case "allow", "disallow":
+			//Paths with wildcards are patterns, not something that can be navigated to
+			if !strings.HasPrefix(value, "/") || strings.ContainsAny(value, "*$") {
+				continue
+			}
+			urls = append(urls, Url{Url: origin + value, Source: "robots.txt"})
+		case "sitemap":
+			sitemaps = append(sitemaps, value)
+		}
+	}
+	return urls, sitemaps
+}
+
+type sitemapFile struct {
+	XMLName xml.Name
+	Urls    []struct {
+		Loc string `xml:"loc"`
+	} `xml:"url"`
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+// sitemaps returns the urls listed in the sitemaps, sitemap indexes are followed. host is the host of the seeded target.
+func (s *Seeder) sitemaps(ctx context.Context, sitemaps []string, host string) []Url {
+	urls := []Url{}
+	seen := map[string]bool{}
+
+	for len(sitemaps) != 0 && len(seen) < maxSitemaps {
+		sitemap := sitemaps[0]
+		sitemaps = sitemaps[1:]
+		if seen[sitemap] {
+			continue
+		}
+		seen[sitemap] = true
+
+		//robots.txt and sitemap indexes can point anywhere
+		if !s.inScope(sitemap, host) {
+			s.log().Debug("skipping out of scope sitemap", zap.String("url", sitemap))
+			continue
+		}
+
+		body, _, err := s.get(ctx, sitemap)
+		if err != nil {
+			continue
+		}
+		//Sitemaps are often served gzipped as .xml.gz
+		if bytes.HasPrefix(body, []byte{0x1f, 0x8b}) {
+			r, err := gzip.NewReader(bytes.NewReader(body))
+			if err != nil {
+				continue
+			}
+			body, err = io.ReadAll(io.LimitReader(r, maxBodySize))
+			if err != nil {
+				continue
+			}
+		}
+
+		var f sitemapFile
+		err = xml.Unmarshal(body, &f)
+		if err != nil {
+			s.log().Debug("failed parsing sitemap", zap.Error(err), zap.String("url", sitemap))
+			continue
+		}
+		for _, u := range f.Urls {
+			urls = append(urls, Url{Url: strings.TrimSpace(u.Loc), Source: "sitemap.xml"})
+		}
+		for _, sm := range f.Sitemaps {
+			sitemaps = append(sitemaps, strings.TrimSpace(sm.Loc))
+		}
+	}
+	return urls
+}
+
+// inScope reports if the host of u is in the scope of the seeder, host is the host of the seeded target
+func (s *Seeder) inScope(u string, host string) bool {
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Hostname() == "" {
+		return false
+	}
+	if len(s.Scope) == 0 {
+		return scope.InScope(parsed.Hostname(), []string{host})
+	}
+	return scope.InScope(parsed.Hostname(), s.Scope)
+}
+
+func isHTML(body []byte) bool {
+	start := strings.ToLower(strings.TrimSpace(string(body[:min(len(body), 512)])))
+	return strings.HasPrefix(start, "<!doctype html") || strings.HasPrefix(start, "<html")
+}
+
+// get returns the body and the url after redirects, an error is returned for non 200 responses
+func (s *Seeder) get(ctx context.Context, u string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	for name, value := range s.Headers {
+		req.Header.Set(name, value)
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		s.log().Debug("failed fetching seed file", zap.Error(err), zap.String("url", u))
+		return nil, "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxBodySize))
+	if err != nil {
+		return nil, "", err
+	}
+	return body, res.Request.URL.String(), nil
+}
@@ -0,0 +1,196 @@
+package sourcemap
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Never read more than this from one script or source map
+const maxBodySize = 50 * 1024 * 1024
+
+var sourceMappingURLRegex = regexp.MustCompile(`[#@]\s*sourceMappingURL=(\S+)\s*(?:\*/)?\s*$`)
+
+// Map is the part of a source map needed to reconstruct the original sources
+type Map struct {
+	Version        int       `json:"version"`
+	File           string    `json:"file"`
+	SourceRoot     string    `json:"sourceRoot"`
+	Sources        []string  `json:"sources"`
+	SourcesContent []*string `json:"sourcesContent"`
+}
+
+func Parse(content string) (*Map, error) {
+	//Some servers prefix the json with )]}' to prevent it from being included as a script
+	content = strings.TrimPrefix(content, ")]}'")
+	var m Map
+	err := json.Unmarshal([]byte(content), &m)
+	if err != nil {
+		return nil, err
+	}
+	if len(m.Sources) == 0 {
+		return nil, fmt.Errorf("source map has no sources")
+	}
+	return &m, nil
+}
+
+// Export writes the sources that have their content in the source map to dir, it returns the number of written files.
+// Source paths are sanitized so nothing is written outside of dir.
+func (m *Map) Export(dir string) (int, error) {
+	written := 0
+	for i, source := range m.Sources {
+		if i >= len(m.SourcesContent) || m.SourcesContent[i] == nil {
+			continue
+		}
+
+		file := filepath.Join(dir, sanitize(m.SourceRoot+source))
+		err := os.MkdirAll(filepath.Dir(file), 0o755)
+		if err != nil {
+			return written, err
+		}
+		err = os.WriteFile(file, []byte(*m.SourcesContent[i]), 0o644)
+		if err != nil {
+			return written, err
+		}
+		written++
+	}
+	return written, nil
+}
+
+// sanitize turns a source like webpack:///./src/../app.js into a relative path that stays within the export directory
+func sanitize(source string) string {
+	if _, rest, ok := strings.Cut(source, "://"); ok {
+		source = rest
+	}
+	source, _, _ = strings.Cut(source, "?")
+	//Cleaning it as an absolute path removes all .. that would escape the root
+	p := strings.TrimPrefix(path.Clean("/"+source), "/")
+	if p == "" {
+		p = "unnamed"
+	}
+	return filepath.FromSlash(p)
+}
+
+// MapURL returns the absolute url of the source map of a script, from the SourceMap header or the sourceMappingURL comment.
+// Empty is returned if the script has no source map.
+func MapURL(scriptURL string, headers http.Header, body string) string {
+	ref := headers.Get("SourceMap")
+	if ref == "" {
+		ref = headers.Get("X-SourceMap")
+	}
+	if ref == "" {
+		//The comment must be at the end of the file, so only look there
+		tail := body[max(0, len(body)-4096):]
+		m := sourceMappingURLRegex.FindStringSubmatch(tail)
+		if m == nil {
+			return ""
+		}
+		ref = m[1]
+	}
+
+	if strings.HasPrefix(ref, "data:") {
+		return ref
+	}
+	base, err := url.Parse(scriptURL)
+	if err != nil {
+		return ""
+	}
+	u, err := base.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	return u.String()
+}
+
+// Fetcher downloads the source maps of scripts, every script is only looked at once. It is safe to use by multiple go routines.
+type Fetcher struct {
+	//Extra headers sent with every request, e.g. for authentication
+	Headers map[string]string
+
+	client *http.Client
+	lock   sync.Mutex
+	seen   map[string]bool
+}
+
+func NewFetcher(headers map[string]string) *Fetcher {
+	//Set InsecureSkipVerify as we want to be able to crawl pages with bad certificates
+	tr := &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+	return &Fetcher{Headers: headers, client: &http.Client{Transport: tr, Timeout: time.Second * 30}, seen: map[string]bool{}}
+}
+
+// First reports if this is the first time the script is seen, and marks it as seen
+func (f *Fetcher) First(scriptURL string) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.seen[scriptURL] {
+		return false
+	}
+	f.seen[scriptURL] = true
+	return true
+}
+
+// Script downloads a script to find its source map when the response was not captured
+func (f *Fetcher) Script(ctx context.Context, scriptURL string) (http.Header, string, error) {
+	return f.get(ctx, scriptURL)
+}
+
+// Fetch downloads the source map at mapURL, data urls are decoded
+func (f *Fetcher) Fetch(ctx context.Context, mapURL string) (string, error) {
+	if strings.HasPrefix(mapURL, "data:") {
+		return decodeDataURL(mapURL)
+	}
+	_, body, err := f.get(ctx, mapURL)
+	return body, err
+}
+
+func (f *Fetcher) get(ctx context.Context, u string) (http.Header, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	for name, value := range f.Headers {
+		req.Header.Set(name, value)
+	}
+
+	res, err := f.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxBodySize))
+	if err != nil {
+		return nil, "", err
+	}
+	return res.Header, string(body), nil
+}
+
+func decodeDataURL(u string) (string, error) {
+	meta, data, ok := strings.Cut(strings.TrimPrefix(u, "data:"), ",")
+	if !ok {
+		return "", fmt.Errorf("invalid data url")
+	}
+	if strings.HasSuffix(meta, ";base64") {
+		b, err := base64.StdEncoding.DecodeString(data)
+		return string(b), err
+	}
+	return url.PathUnescape(data)
+}
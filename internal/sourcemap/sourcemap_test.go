@@ -0,0 +1,163 @@
+package sourcemap
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"webpack:///./src/app.js", "src/app.js"},
+		{"webpack:///./src/../app.js", "app.js"},
+		{"../../etc/passwd", "etc/passwd"},
+		{"webpack:///../../etc/passwd", "etc/passwd"},
+		{"/etc/passwd", "etc/passwd"},
+		{"https://example.com/../../etc/passwd", "etc/passwd"},
+		{"src/app.js?v=1", "src/app.js"},
+		{"webpack:///", "unnamed"},
+		{"..", "unnamed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			if got := sanitize(tt.source); got != filepath.FromSlash(tt.want) {
+				t.Errorf("sanitize(%q) = %q, want %q", tt.source, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportStaysInDir(t *testing.T) {
+	content := "x"
+	m := &Map{
+		SourceRoot: "webpack:///../../",
+		Sources:    []string{"../outside.js", "src/app.js"},
+		SourcesContent: []*string{
+			&content,
+			&content,
+		},
+	}
+	root := t.TempDir()
+	dir := filepath.Join(root, "export")
+
+	written, err := m.Export(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != 2 {
+		t.Errorf("wrote %d files, want 2", written)
+	}
+	err = filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && !strings.HasPrefix(p, dir+string(filepath.Separator)) {
+			t.Errorf("%s was written outside of the export directory", p)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"outside.js", "src/app.js"} {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(f))); err != nil {
+			t.Errorf("%s was not exported: %s", f, err)
+		}
+	}
+}
+
+func TestExportWithSchemeSourceRoot(t *testing.T) {
+	content := "x"
+	m := &Map{SourceRoot: "https://example.com/../../", Sources: []string{"app.js"}, SourcesContent: []*string{&content}}
+	dir := t.TempDir()
+
+	_, err := m.Export(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "app.js")); err != nil {
+		t.Errorf("app.js was not exported in the directory: %s", err)
+	}
+}
+
+func TestMapURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers http.Header
+		body    string
+		want    string
+	}{
+		{"comment", nil, "var a;\n//# sourceMappingURL=app.js.map", "https://example.com/js/app.js.map"},
+		{"old comment", nil, "var a;\n//@ sourceMappingURL=app.js.map\n", "https://example.com/js/app.js.map"},
+		{"css comment", nil, "a{}\n/*# sourceMappingURL=/maps/app.map */", "https://example.com/maps/app.map"},
+		{"absolute", nil, "//# sourceMappingURL=https://cdn.example.com/app.map", "https://cdn.example.com/app.map"},
+		{"header", http.Header{"Sourcemap": {"../app.map"}}, "var a;", "https://example.com/app.map"},
+		{"old header", http.Header{"X-Sourcemap": {"app.map"}}, "var a;", "https://example.com/js/app.map"},
+		{"header wins", http.Header{"Sourcemap": {"header.map"}}, "//# sourceMappingURL=comment.map", "https://example.com/js/header.map"},
+		{"data url", nil, "//# sourceMappingURL=data:application/json;base64,e30=", "data:application/json;base64,e30="},
+		{"not at the end", nil, "//# sourceMappingURL=app.js.map\nvar a;", ""},
+		{"none", nil, "var a;", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := tt.headers
+			if headers == nil {
+				headers = http.Header{}
+			}
+			if got := MapURL("https://example.com/js/app.js", headers, tt.body); got != tt.want {
+				t.Errorf("MapURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeDataURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		want    string
+		wantErr bool
+	}{
+		{"data:application/json;base64,eyJ2ZXJzaW9uIjozfQ==", `{"version":3}`, false},
+		{"data:application/json;charset=utf-8;base64,e30=", "{}", false},
+		{"data:application/json,%7B%22version%22%3A3%7D", `{"version":3}`, false},
+		{"data:application/json;base64,not base64", "", true},
+		{"data:application/json", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			got, err := decodeDataURL(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeDataURL() error = %v, want error %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("decodeDataURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchStopsWhenCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	start := time.Now()
+	_, err := NewFetcher(nil).Fetch(ctx, server.URL+"/app.js.map")
+	if err == nil {
+		t.Fatal("the canceled download did not fail")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second*5 {
+		t.Errorf("the download took %s after it was canceled", elapsed)
+	}
+}
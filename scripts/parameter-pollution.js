@@ -0,0 +1,27 @@
+// Parameter pollution: every in scope link with a query gets each of its parameters sent twice, the second time with a
+// marker value. The urls are crawled and a finding is reported for the page if the marker is already in it, e.g. from an
+// earlier polluted url.
+async () => {
+    const marker = "rcpp1337";
+    const urls = [];
+    for (const a of document.querySelectorAll("a[href]")) {
+        let u;
+        try {
+            u = new URL(a.href, document.baseURI);
+        } catch (e) {
+            continue;
+        }
+        if (u.origin !== location.origin || !u.search) continue;
+        for (const name of new Set(u.searchParams.keys())) {
+            const polluted = new URL(u);
+            polluted.searchParams.append(name, marker);
+            urls.push(polluted.href);
+        }
+    }
+
+    const findings = [];
+    if (location.search.includes(marker) && document.documentElement.innerHTML.includes(marker)) {
+        findings.push({title: "polluted parameter reflected", detail: {url: location.href}});
+    }
+    return {findings: findings, urls: urls};
+}